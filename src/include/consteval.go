@@ -0,0 +1,381 @@
+package include
+
+import (
+	"fmt"
+	"go/constant"
+	"go/token"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Constants are evaluated while checking: literals, names declared with `#=`,
+// the arithmetic, bitwise, comparison and `::` operators on them, and `::x`.
+// A type is held as its name, e.g. "[]int", which is unique to it. Untyped
+// values are exact, however big, up to maxConstBits. Typed ones have to fit
+// their type, so `255u8 + 1` is an error rather than wrapping around.
+
+// maxConstBits bounds the size of an integer constant, and with it of a
+// shift count and an exponent.
+const maxConstBits = 512
+
+var tokenOps = map[ASTKind]token.Token{
+	AST_Add:            token.ADD,
+	AST_Sub:            token.SUB,
+	AST_Mul:            token.MUL,
+	AST_Mod:            token.REM,
+	AST_BAnd:           token.AND,
+	AST_BOr:            token.OR,
+	AST_BXor:           token.XOR,
+	AST_Equal:          token.EQL,
+	AST_NotEqual:       token.NEQ,
+	AST_Greater:        token.GTR,
+	AST_Lesser:         token.LSS,
+	AST_GreaterOrEqual: token.GEQ,
+	AST_LesserOrEqual:  token.LEQ,
+}
+
+// constDecl checks `x #= value`. The value keeps its type, untyped included,
+// so that `x` takes the type of where it is used just like a literal would.
+func (c *Checker) constDecl(node *ASTNode) {
+	reported := len(c.Diags)
+	typ := c.expr(node.RHS)
+
+	// An overflow or division by zero has been reported already
+	if _, ok := c.Info.Values[node.RHS]; !ok && !isInvalid(typ) && len(c.Diags) == reported {
+		err := fmt.Sprintf("Value of constant `%s` isn't known at compile time", node.LHS.Value)
+		c.Diags = append(c.Diags, &Diagnostic{
+			Code:    55,
+			Message: err,
+			Span:    node.RHS.Span,
+			Notes: []string{
+				"a constant is made of literals, other constants and operators on them",
+				"declare it with `:=` to make it a variable",
+			},
+		})
+		typ = Typ[TYP_Invalid]
+	}
+
+	c.declare(node.LHS, SYM_Const, typ, node)
+}
+
+// constant returns the value of node if it is known at compile time, from
+// the values of its operands. typ is the type node was checked to have.
+func (c *Checker) constant(node *ASTNode, typ Type) constant.Value {
+	if isInvalid(typ) {
+		return nil
+	}
+
+	switch node.Kind {
+	case AST_Int, AST_Hex, AST_Octal, AST_Binary:
+		return constant.MakeUint64(node.Int)
+	case AST_Float:
+		if val := constant.MakeFromLiteral(node.Value, token.FLOAT, 0); val.Kind() != constant.Unknown {
+			return val
+		}
+
+		return constant.MakeFloat64(node.Float)
+	case AST_Char:
+		char, _ := utf8.DecodeRuneInString(node.Value)
+		return constant.MakeInt64(int64(char))
+	case AST_String, AST_TypeValue:
+		return constant.MakeString(node.Value)
+	case AST_True, AST_False:
+		return constant.MakeBool(node.Kind == AST_True)
+	case AST_Id:
+		if sym := c.Info.Uses[node]; sym != nil && sym.Kind == SYM_Const {
+			return c.Info.Values[sym.Decl.RHS]
+		}
+	case AST_Group:
+		if len(node.Params) == 1 {
+			return c.Info.Values[node.Params[0][0]]
+		}
+	case AST_Not:
+		if x := c.Info.Values[node.LHS]; x != nil {
+			return constant.UnaryOp(token.NOT, x, 0)
+		}
+	case AST_BNot:
+		if x := c.Info.Values[node.LHS]; x != nil {
+			// Unsigned values flip only the bits of their size
+			var prec uint
+			if hasInfo(typ, INF_Unsigned) {
+				prec = uint(SizeOf(typ) * 8)
+			}
+
+			return constant.UnaryOp(token.XOR, x, prec)
+		}
+	case AST_Neg:
+		if x := c.Info.Values[node.LHS]; x != nil {
+			return c.fits(node, typ, constant.UnaryOp(token.SUB, x, 0))
+		}
+	case AST_TypeOf:
+		// Every type is known while checking, so `::x` is a constant and x
+		// is never run
+		return constant.MakeString(c.Info.Types[node.LHS].String())
+	case AST_TypeCast:
+		return c.constCast(node, typ)
+	}
+
+	if _, ok := binaryKinds[node.Kind]; ok {
+		return c.constBinary(node, typ)
+	}
+
+	return nil
+}
+
+func (c *Checker) constBinary(node *ASTNode, typ Type) constant.Value {
+	x, y := c.Info.Values[node.LHS], c.Info.Values[node.RHS]
+	if x == nil || y == nil {
+		return nil
+	}
+
+	var val constant.Value
+
+	switch node.Kind {
+	case AST_And:
+		return constant.MakeBool(constant.BoolVal(x) && constant.BoolVal(y))
+	case AST_Or:
+		return constant.MakeBool(constant.BoolVal(x) || constant.BoolVal(y))
+	case AST_Equal, AST_NotEqual, AST_Greater, AST_Lesser, AST_GreaterOrEqual, AST_LesserOrEqual:
+		return constant.MakeBool(constant.Compare(x, tokenOps[node.Kind], y))
+	case AST_BLeft, AST_BRight:
+		count, ok := constant.Uint64Val(constant.ToInt(y))
+		if !ok || count > maxConstBits {
+			err := fmt.Sprintf("Shift count %s is out of range", y)
+			c.report(58, node.RHS.Span, err)
+			return nil
+		}
+
+		op := token.SHL
+		if node.Kind == AST_BRight {
+			op = token.SHR
+		}
+
+		val = constant.Shift(x, op, uint(count))
+	case AST_Div, AST_Mod:
+		if constant.Sign(y) == 0 {
+			c.report(57, node.RHS.Span, "Division by zero")
+			return nil
+		}
+
+		op := tokenOps[node.Kind]
+		if node.Kind == AST_Div {
+			op = token.QUO
+			if isInteger(typ) {
+				op = token.QUO_ASSIGN // integer division
+			}
+		}
+
+		val = constant.BinaryOp(x, op, y)
+	case AST_Pow:
+		if isInteger(typ) && constant.Sign(y) < 0 {
+			err := fmt.Sprintf("Negative exponent %s in an integer power", y)
+			c.Diags = append(c.Diags, &Diagnostic{
+				Code:    59,
+				Message: err,
+				Span:    c.opSpan(node, "^"),
+				Labels:  []Label{{node.RHS.Span, "exponent"}},
+				Notes:   []string{"an integer power can't be a fraction, raise a float for one"},
+			})
+			return nil
+		}
+
+		if val = constPow(x, y, isInteger(typ)); val == nil {
+			return nil
+		}
+	default:
+		op, ok := tokenOps[node.Kind]
+		if !ok {
+			return nil
+		}
+
+		val = constant.BinaryOp(x, op, y)
+	}
+
+	if val.Kind() == constant.Int && constant.BitLen(val) > maxConstBits {
+		err := fmt.Sprintf("Constant is too big, over %d bits", maxConstBits)
+		c.report(36, node.Span, err)
+		return nil
+	}
+
+	return c.fits(node, typ, val)
+}
+
+// fits returns the value val of node, reporting it and returning nil instead
+// if it doesn't fit in typ.
+func (c *Checker) fits(node *ASTNode, typ Type, val constant.Value) constant.Value {
+	if basic, ok := typ.(*Basic); ok && isNumeric(basic) && !isUntyped(basic) {
+		if err := representable(val, basic); err != "" {
+			c.report(36, node.Span, err)
+			return nil
+		}
+	}
+
+	return val
+}
+
+// opSpan returns the span of the operator op of the binary expression node,
+// found in the source between its operands, or the whole node's if the source
+// isn't at hand.
+func (c *Checker) opSpan(node *ASTNode, op string) Span {
+	from, to := node.LHS.Span.End, node.RHS.Span.Start
+	if from.Offset > to.Offset || to.Offset > len(c.Src) {
+		return node.Span
+	}
+
+	i := strings.Index(c.Src[from.Offset:to.Offset], op)
+	if i < 0 {
+		return node.Span
+	}
+
+	start := from
+	for _, char := range c.Src[from.Offset : from.Offset+i] {
+		start.Offset += utf8.RuneLen(char)
+		start.Col++
+
+		if char == '\n' {
+			start.Line++
+			start.Col = 1
+		}
+	}
+
+	end := start
+	end.Offset += len(op)
+	end.Col += utf8.RuneCountInString(op)
+
+	return Span{File: node.Span.File, Start: start, End: end}
+}
+
+// constPow raises x to the power y. An integer power needs an exponent that
+// isn't negative, which constBinary checks, and is left to run time if the
+// exponent is too big. Floats go through float64.
+func constPow(x, y constant.Value, integer bool) constant.Value {
+	if integer {
+		exp, ok := constant.Uint64Val(y)
+		if !ok || exp > maxConstBits {
+			return nil
+		}
+
+		val := constant.MakeInt64(1)
+		for ; exp > 0; exp >>= 1 {
+			if exp&1 == 1 {
+				val = constant.BinaryOp(val, token.MUL, x)
+			}
+
+			x = constant.BinaryOp(x, token.MUL, x)
+		}
+
+		return val
+	}
+
+	base, _ := constant.Float64Val(x)
+	exp, _ := constant.Float64Val(y)
+
+	val := constant.MakeFloat64(math.Pow(base, exp))
+	if val.Kind() == constant.Unknown {
+		return nil
+	}
+
+	return val
+}
+
+// constCast converts a constant with `::`. A float becomes an integer by
+// truncating toward zero, and the value has to fit the new type. Numbers and
+// bools become strings as they print, and a rune the character it is.
+func (c *Checker) constCast(node *ASTNode, typ Type) constant.Value {
+	x := c.Info.Values[node.LHS]
+	to, ok := typ.(*Basic)
+	if x == nil || !ok {
+		return nil
+	}
+
+	var val constant.Value
+
+	switch {
+	case isInteger(to) && x.Kind() == constant.Float:
+		f, _ := constant.Float64Val(x)
+		val = constant.ToInt(constant.MakeFloat64(math.Trunc(f)))
+	case isInteger(to):
+		val = constant.ToInt(x)
+	case hasInfo(to, INF_Float):
+		val = constant.ToFloat(x)
+	case isBasic(to, TYP_String):
+		switch x.Kind() {
+		case constant.String:
+			val = x
+		case constant.Float:
+			f, _ := constant.Float64Val(x)
+			val = constant.MakeString(strconv.FormatFloat(f, 'g', -1, 64))
+		case constant.Int:
+			if isBasic(c.Info.Types[node.LHS], TYP_Rune) {
+				char, _ := constant.Int64Val(x)
+				val = constant.MakeString(string(rune(char)))
+				break
+			}
+
+			val = constant.MakeString(x.ExactString())
+		default:
+			val = constant.MakeString(x.ExactString())
+		}
+	case isBasic(to, TYP_Bool):
+		val = x
+	default:
+		return nil
+	}
+
+	if val.Kind() == constant.Unknown {
+		return nil
+	}
+
+	if isNumeric(to) {
+		if err := representable(val, to); err != "" {
+			c.report(36, node.Span, err)
+			return nil
+		}
+	}
+
+	return val
+}
+
+// representable returns why val doesn't fit in the numeric type to, or an
+// empty string if it does.
+func representable(val constant.Value, to *Basic) string {
+	if to.Info&INF_Float != 0 {
+		var fits, exact bool
+		if to.Kind == TYP_F32 {
+			f, ok := constant.Float32Val(val)
+			fits, exact = !math.IsInf(float64(f), 0), ok
+		} else {
+			f, ok := constant.Float64Val(val)
+			fits, exact = !math.IsInf(f, 0), ok
+		}
+
+		switch {
+		case !fits:
+			return fmt.Sprintf("Constant %s overflows `%s`", val, to)
+		case !exact && val.Kind() == constant.Int:
+			return fmt.Sprintf("Constant %s can't be held exactly by `%s`", val, to)
+		}
+
+		return ""
+	}
+
+	val = constant.ToInt(val)
+	bits := uint(to.Size * 8)
+
+	if to.Info&INF_Unsigned != 0 {
+		max := constant.Shift(constant.MakeUint64(1), token.SHL, bits)
+		if constant.Sign(val) >= 0 && constant.Compare(val, token.LSS, max) {
+			return ""
+		}
+	} else {
+		max := constant.Shift(constant.MakeUint64(1), token.SHL, bits-1)
+		min := constant.UnaryOp(token.SUB, max, 0)
+		if constant.Compare(val, token.GEQ, min) && constant.Compare(val, token.LSS, max) {
+			return ""
+		}
+	}
+
+	return fmt.Sprintf("Constant %s overflows `%s`", val, to)
+}
@@ -0,0 +1,100 @@
+package include
+
+import "testing"
+
+func TestConstantValues(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"2 ^ 10", "1024"},
+		{"7 / 2", "3"},
+		{"7 / 2.0", "3.5"},
+		{"7 % 3", "1"},
+		{"2.0 ^ -1", "0.5"},
+		{"-(2 - 5)", "3"},
+		{"-2 ^ 2", "-4"},
+		{"(-2) ^ 2", "4"},
+		{"-2 ^ 3 ^ 2 + 1", "-511"},
+		{"0xFF .& .!0x0F", "240"},
+		{".!0u8", "255"},
+		{"1 .< 10 .| 1", "1025"},
+		{"3 > 2 & 1 == 1", "true"},
+		{"\"wi\" + \"sp\"", `"wisp"`},
+		{"2.9 :: int", "2"},
+		{"-2.9 :: int", "-2"},
+		{"42 :: string", `"42"`},
+		{"'a' :: string", `"a"`},
+		{"true :: string", `"true"`},
+		{"300 :: f32", "300"},
+		{"::1 == int", "true"},
+		{"::1 != ::1.5", "true"},
+		{"::\"a\"", `"string"`},
+		{"limit * 2", "20"},
+	}
+
+	for _, test := range tests {
+		file, info, diags := checkSrc(t, "limit #= 10\nc #= "+test.expr)
+		if len(diags) > 0 {
+			t.Errorf("%s: unexpected %s", test.expr, diags[0].Message)
+			continue
+		}
+
+		val := info.Values[file.Root.Children[1].RHS]
+		if val == nil || val.String() != test.want {
+			t.Errorf("%s = %v, want %s", test.expr, val, test.want)
+		}
+	}
+}
+
+func TestConstantErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		code int
+		msg  string
+		col  int
+	}{
+		{"255u8 + 1", 36, "Constant 256 overflows `u8`", 6},
+		{"300 :: u8", 36, "Constant 300 overflows `u8`", 6},
+		{"-1u8", 36, "Constant -1 overflows `u8`", 6},
+		{"1e40 :: f32", 36, "Constant 1e+40 overflows `f32`", 6},
+		{"1 / 0", 57, "Division by zero", 10},
+		{"1.5 / 0.0", 57, "Division by zero", 12},
+		{"1 .< 1000", 58, "Shift count 1000 is out of range", 11},
+		{"1 .> -1", 58, "Shift count -1 is out of range", 11},
+		{"2 ^ -1", 59, "Negative exponent -1 in an integer power", 8},
+	}
+
+	for _, test := range tests {
+		_, _, diags := checkSrc(t, "c #= "+test.expr)
+		if len(diags) != 1 || diags[0].Code != test.code || diags[0].Message != test.msg {
+			t.Errorf("%s: got %v, want E%03d %s", test.expr, diags, test.code, test.msg)
+			continue
+		}
+
+		if col := diags[0].Span.Start.Col; col != test.col {
+			t.Errorf("%s: reported at column %d, want %d", test.expr, col, test.col)
+		}
+	}
+}
+
+func TestInlineConstants(t *testing.T) {
+	file, info, diags := checkSrc(t, "limit #= 10\nname #= \"wisp\"\non #= limit > 5\nx := limit * 2\ny := name\nz := on\nw := -limit\nk := ::name\nsame := ::limit == int")
+	if len(diags) > 0 {
+		t.Fatal(diags[0].Message)
+	}
+
+	InlineConstants(file.Root, info)
+
+	want := `(root (variable-declaration (identifier "x") (integer "20")) (variable-declaration (identifier "y") (string "wisp")) (variable-declaration (identifier "z") (true)) (variable-declaration (identifier "w") (integer "-10")) (variable-declaration (identifier "k") (type-value "string")) (variable-declaration (identifier "same") (true)))`
+	if got := Sexpr(file.Root); got != want {
+		t.Errorf("InlineConstants:\n got %s\nwant %s", got, want)
+	}
+
+	// Booleans are told apart by their kind alone
+	on := file.Root.Children[2].RHS
+	if on.Value != "" || on.Raw != "" {
+		t.Errorf("inlined `true` has Value %q and Raw %q, want them empty", on.Value, on.Raw)
+	}
+}
@@ -0,0 +1,607 @@
+package include
+
+import (
+	"fmt"
+	"slices"
+)
+
+var literalKinds = []ASTKind{
+	AST_Int, AST_Float, AST_Binary, AST_Octal, AST_Hex,
+	AST_String, AST_Char, AST_True, AST_False, AST_Nil, AST_TypeValue,
+}
+
+var stmtKinds = []ASTKind{
+	AST_Variable, AST_Constant, AST_Assign, AST_Inc, AST_Dec,
+	AST_If, AST_While, AST_For,
+	AST_Return, AST_Exit, AST_ExitCode, AST_ExitNow,
+	AST_Block, AST_Function,
+}
+
+// FromAST converts a tree of ASTNodes to the typed tree. An AST_Root becomes
+// a *Program, statements a Stmt and anything else an Expr. A node whose
+// fields don't have the shape its kind calls for is an error.
+func FromAST(node *ASTNode) (Node, error) {
+	switch {
+	case node == nil:
+		return nil, nil
+	case node.Kind == AST_Root:
+		stmts, err := stmtsFromAST(node.Children)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Program{Span: node.Span, Stmts: stmts}, nil
+	case slices.Contains(stmtKinds, node.Kind):
+		return stmtFromAST(node)
+	default:
+		return exprFromAST(node)
+	}
+}
+
+func stmtsFromAST(nodes []*ASTNode) ([]Stmt, error) {
+	stmts := []Stmt{}
+
+	for _, node := range nodes {
+		stmt, err := stmtFromAST(node)
+		if err != nil {
+			return nil, err
+		}
+
+		stmts = append(stmts, stmt)
+	}
+
+	return stmts, nil
+}
+
+func stmtFromAST(node *ASTNode) (Stmt, error) {
+	switch node.Kind {
+	case AST_Bad:
+		return &BadNode{Span: node.Span}, nil
+	case AST_Variable, AST_Constant:
+		if node.LHS == nil || node.LHS.Kind != AST_Id {
+			return nil, shapeError(node, "a name in LHS")
+		}
+
+		value, err := exprFromAST(node.RHS)
+		if err != nil {
+			return nil, err
+		}
+
+		name := &Ident{Span: node.LHS.Span, Name: node.LHS.Value}
+		return &VarDecl{Span: node.Span, Doc: node.Doc, Const: node.Kind == AST_Constant, Name: name, Value: value}, nil
+	case AST_Assign:
+		target, err := exprFromAST(node.LHS)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := exprFromAST(node.RHS)
+		if err != nil {
+			return nil, err
+		}
+
+		return &AssignStmt{Span: node.Span, Target: target, Value: value}, nil
+	case AST_Inc, AST_Dec:
+		x, err := exprFromAST(node.LHS)
+		if err != nil {
+			return nil, err
+		}
+
+		return &IncDecStmt{Span: node.Span, Op: node.Kind, X: x}, nil
+	case AST_If:
+		cond, err := exprFromAST(node.LHS)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := blockFromAST(node.RHS)
+		if err != nil {
+			return nil, err
+		}
+
+		stmt := &IfStmt{Span: node.Span, Cond: cond, Body: body}
+
+		if node.Alt != nil {
+			if node.Alt.Kind != AST_Else || node.Alt.LHS == nil {
+				return nil, shapeError(node, "an else in Alt")
+			}
+
+			stmt.ElseSpan = node.Alt.Span
+			if stmt.Else, err = stmtFromAST(node.Alt.LHS); err != nil {
+				return nil, err
+			}
+		}
+
+		return stmt, nil
+	case AST_While:
+		cond, err := exprFromAST(node.LHS)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := blockFromAST(node.RHS)
+		if err != nil {
+			return nil, err
+		}
+
+		return &WhileStmt{Span: node.Span, Cond: cond, Body: body}, nil
+	case AST_For:
+		stmt := &ForStmt{Span: node.Span}
+
+		var err error
+		if node.LHS != nil && node.LHS.Kind == AST_Group && len(node.LHS.Params) == 3 {
+			stmt.Clauses = true
+			stmt.ClauseSpan = node.LHS.Span
+			clauses := node.LHS.Params
+
+			if stmt.Init, err = clauseFromAST(clauses[0]); err != nil {
+				return nil, err
+			}
+			if stmt.Cond, err = singleFromAST(clauses[1]); err != nil {
+				return nil, err
+			}
+			if stmt.Post, err = clauseFromAST(clauses[2]); err != nil {
+				return nil, err
+			}
+		} else if stmt.Cond, err = exprFromAST(node.LHS); err != nil {
+			return nil, err
+		}
+
+		if stmt.Body, err = blockFromAST(node.RHS); err != nil {
+			return nil, err
+		}
+
+		return stmt, nil
+	case AST_Return:
+		value, err := exprFromAST(node.LHS)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ReturnStmt{Span: node.Span, Value: value}, nil
+	case AST_Exit, AST_ExitCode, AST_ExitNow:
+		code, err := exprFromAST(node.LHS)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ExitStmt{Span: node.Span, Op: node.Kind, Code: code}, nil
+	case AST_Block:
+		return blockFromAST(node)
+	case AST_Function:
+		return funcFromAST(node)
+	}
+
+	x, err := exprFromAST(node)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExprStmt{Span: node.Span, X: x}, nil
+}
+
+func blockFromAST(node *ASTNode) (*Block, error) {
+	if node == nil || node.Kind != AST_Block {
+		return nil, fmt.Errorf("expected a block, found %v", node)
+	}
+
+	stmts, err := stmtsFromAST(node.Children)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Block{Span: node.Span, Stmts: stmts}, nil
+}
+
+// clauseFromAST converts a `for` clause, which holds one statement or none.
+func clauseFromAST(clause []*ASTNode) (Stmt, error) {
+	if len(clause) == 0 {
+		return nil, nil
+	}
+
+	return stmtFromAST(clause[0])
+}
+
+func funcFromAST(node *ASTNode) (*FuncDecl, error) {
+	fn := &FuncDecl{Span: node.Span, Doc: node.Doc, Name: node.Value}
+
+	for _, param := range node.Params {
+		if len(param) != 2 || param[0].Kind != AST_Id {
+			return nil, shapeError(node, "`name type` pairs in Params")
+		}
+
+		typ, err := exprFromAST(param[1])
+		if err != nil {
+			return nil, err
+		}
+
+		fn.Params = append(fn.Params, &Param{Name: &Ident{Span: param[0].Span, Name: param[0].Value}, Type: typ})
+	}
+
+	if ret := node.RHS; ret != nil {
+		typ, err := exprFromAST(ret.LHS)
+		if err != nil {
+			return nil, err
+		}
+
+		second, err := exprFromAST(ret.RHS)
+		if err != nil {
+			return nil, err
+		}
+
+		fn.Result = &Result{Span: ret.Span, Arrow: ret.Kind, Type: typ, Second: second}
+	}
+
+	body, err := stmtsFromAST(node.Children)
+	if err != nil {
+		return nil, err
+	}
+
+	fn.Body = body
+	return fn, nil
+}
+
+func exprFromAST(node *ASTNode) (Expr, error) {
+	if node == nil {
+		return nil, nil
+	}
+
+	if slices.Contains(literalKinds, node.Kind) {
+		return &Literal{
+			Span:   node.Span,
+			Kind:   node.Kind,
+			Value:  node.Value,
+			Raw:    node.Raw,
+			Suffix: node.Suffix,
+			Int:    node.Int,
+			Float:  node.Float,
+		}, nil
+	}
+
+	switch node.Kind {
+	case AST_Bad:
+		return &BadNode{Span: node.Span}, nil
+	case AST_Id:
+		return &Ident{Span: node.Span, Name: node.Value}, nil
+	case AST_Interp:
+		parts, err := exprsFromAST(node.Children)
+		if err != nil {
+			return nil, err
+		}
+
+		return &InterpString{Span: node.Span, Value: node.Value, Raw: node.Raw, Parts: parts}, nil
+	case AST_Not, AST_BNot, AST_Neg, AST_TypeOf:
+		x, err := exprFromAST(node.LHS)
+		if err != nil {
+			return nil, err
+		}
+
+		return &UnaryExpr{Span: node.Span, Op: node.Kind, X: x}, nil
+	case AST_TypeCast:
+		x, err := exprFromAST(node.LHS)
+		if err != nil {
+			return nil, err
+		}
+
+		typ, err := exprFromAST(node.RHS)
+		if err != nil {
+			return nil, err
+		}
+
+		return &CastExpr{Span: node.Span, X: x, Type: typ}, nil
+	case AST_Call:
+		fn, err := exprFromAST(node.LHS)
+		if err != nil {
+			return nil, err
+		}
+
+		args, err := groupFromAST(node)
+		if err != nil {
+			return nil, err
+		}
+
+		return &CallExpr{Span: node.Span, Fn: fn, Args: args}, nil
+	case AST_Member:
+		x, err := exprFromAST(node.LHS)
+		if err != nil {
+			return nil, err
+		}
+
+		return &MemberExpr{Span: node.Span, X: x, Name: node.Value}, nil
+	case AST_Index:
+		x, err := exprFromAST(node.LHS)
+		if err != nil {
+			return nil, err
+		}
+
+		index, err := exprFromAST(node.RHS)
+		if err != nil {
+			return nil, err
+		}
+
+		return &IndexExpr{Span: node.Span, X: x, Index: index}, nil
+	case AST_Slice:
+		if len(node.Params) != 2 {
+			return nil, shapeError(node, "two bounds in Params")
+		}
+
+		x, err := exprFromAST(node.LHS)
+		if err != nil {
+			return nil, err
+		}
+
+		lo, err := singleFromAST(node.Params[0])
+		if err != nil {
+			return nil, err
+		}
+
+		hi, err := singleFromAST(node.Params[1])
+		if err != nil {
+			return nil, err
+		}
+
+		return &SliceExpr{Span: node.Span, X: x, Lo: lo, Hi: hi}, nil
+	case AST_Group:
+		elems, err := groupFromAST(node)
+		if err != nil {
+			return nil, err
+		}
+
+		return &GroupExpr{Span: node.Span, Elems: elems}, nil
+	case AST_ListId:
+		return listTypeFromAST(node)
+	case AST_List:
+		typ, err := listTypeFromAST(node.LHS)
+		if err != nil {
+			return nil, err
+		}
+
+		elems, err := exprsFromAST(node.Children)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ListLit{Span: node.Span, Type: typ, Elems: elems}, nil
+	}
+
+	if _, ok := binaryKinds[node.Kind]; ok {
+		x, err := exprFromAST(node.LHS)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := exprFromAST(node.RHS)
+		if err != nil {
+			return nil, err
+		}
+
+		return &BinaryExpr{Span: node.Span, Op: node.Kind, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("%s: %s is not an expression", node.Span, node.Kind)
+}
+
+func exprsFromAST(nodes []*ASTNode) ([]Expr, error) {
+	exprs := []Expr{}
+
+	for _, node := range nodes {
+		expr, err := exprFromAST(node)
+		if err != nil {
+			return nil, err
+		}
+
+		exprs = append(exprs, expr)
+	}
+
+	return exprs, nil
+}
+
+// groupFromAST converts the Params of a group or call, one expression each.
+func groupFromAST(node *ASTNode) ([]Expr, error) {
+	exprs := []Expr{}
+
+	for _, param := range node.Params {
+		if len(param) != 1 {
+			return nil, shapeError(node, "one expression per entry of Params")
+		}
+
+		expr, err := exprFromAST(param[0])
+		if err != nil {
+			return nil, err
+		}
+
+		exprs = append(exprs, expr)
+	}
+
+	return exprs, nil
+}
+
+// singleFromAST converts an optional expression kept in a slice, such as a
+// slice bound.
+func singleFromAST(nodes []*ASTNode) (Expr, error) {
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+
+	return exprFromAST(nodes[0])
+}
+
+func listTypeFromAST(node *ASTNode) (*ListType, error) {
+	if node == nil || node.Kind != AST_ListId {
+		return nil, fmt.Errorf("expected a list type, found %v", node)
+	}
+
+	size, err := exprFromAST(node.LHS)
+	if err != nil {
+		return nil, err
+	}
+
+	elem, err := exprFromAST(node.RHS)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListType{Span: node.Span, Len: size, Elem: elem}, nil
+}
+
+func shapeError(node *ASTNode, want string) error {
+	return fmt.Errorf("%s: expected %s of %s", node.Span, want, node.Kind)
+}
+
+// binaryKinds are the kinds of the operators in binaryOps, but for `::`.
+var binaryKinds = func() map[ASTKind]bool {
+	kinds := map[ASTKind]bool{}
+	for _, op := range binaryOps {
+		if op.Kind != AST_TypeCast {
+			kinds[op.Kind] = true
+		}
+	}
+
+	return kinds
+}()
+
+// ToAST converts a typed tree back to ASTNodes.
+func ToAST(n Node) *ASTNode {
+	switch n := n.(type) {
+	case nil:
+		return nil
+	case *Program:
+		return &ASTNode{Kind: AST_Root, Span: n.Span, Children: stmtsToAST(n.Stmts)}
+	case *BadNode:
+		return &ASTNode{Kind: AST_Bad, Span: n.Span}
+	case *Ident:
+		if n == nil {
+			return nil
+		}
+
+		return &ASTNode{Kind: AST_Id, Span: n.Span, Value: n.Name}
+	case *Literal:
+		return &ASTNode{
+			Kind:   n.Kind,
+			Span:   n.Span,
+			Value:  n.Value,
+			Raw:    n.Raw,
+			Suffix: n.Suffix,
+			Int:    n.Int,
+			Float:  n.Float,
+		}
+	case *InterpString:
+		return &ASTNode{Kind: AST_Interp, Span: n.Span, Value: n.Value, Raw: n.Raw, Children: exprsToAST(n.Parts)}
+	case *UnaryExpr:
+		return &ASTNode{Kind: n.Op, Span: n.Span, LHS: ToAST(n.X)}
+	case *BinaryExpr:
+		return &ASTNode{Kind: n.Op, Span: n.Span, LHS: ToAST(n.X), RHS: ToAST(n.Y)}
+	case *CastExpr:
+		return &ASTNode{Kind: AST_TypeCast, Span: n.Span, LHS: ToAST(n.X), RHS: ToAST(n.Type)}
+	case *CallExpr:
+		return &ASTNode{Kind: AST_Call, Span: n.Span, LHS: ToAST(n.Fn), Params: groupToAST(n.Args)}
+	case *MemberExpr:
+		return &ASTNode{Kind: AST_Member, Span: n.Span, LHS: ToAST(n.X), Value: n.Name}
+	case *IndexExpr:
+		return &ASTNode{Kind: AST_Index, Span: n.Span, LHS: ToAST(n.X), RHS: ToAST(n.Index)}
+	case *SliceExpr:
+		return &ASTNode{Kind: AST_Slice, Span: n.Span, LHS: ToAST(n.X), Params: [][]*ASTNode{singleToAST(n.Lo), singleToAST(n.Hi)}}
+	case *GroupExpr:
+		return &ASTNode{Kind: AST_Group, Span: n.Span, Params: groupToAST(n.Elems)}
+	case *ListType:
+		if n == nil {
+			return nil
+		}
+
+		return &ASTNode{Kind: AST_ListId, Span: n.Span, LHS: ToAST(n.Len), RHS: ToAST(n.Elem)}
+	case *ListLit:
+		return &ASTNode{Kind: AST_List, Span: n.Span, LHS: ToAST(n.Type), Children: exprsToAST(n.Elems)}
+	case *ExprStmt:
+		node := ToAST(n.X)
+		node.Span = n.Span
+		return node
+	case *VarDecl:
+		kind := AST_Variable
+		if n.Const {
+			kind = AST_Constant
+		}
+
+		return &ASTNode{Kind: kind, Span: n.Span, Doc: n.Doc, LHS: ToAST(n.Name), RHS: ToAST(n.Value)}
+	case *AssignStmt:
+		return &ASTNode{Kind: AST_Assign, Span: n.Span, LHS: ToAST(n.Target), RHS: ToAST(n.Value)}
+	case *IncDecStmt:
+		return &ASTNode{Kind: n.Op, Span: n.Span, LHS: ToAST(n.X)}
+	case *IfStmt:
+		node := &ASTNode{Kind: AST_If, Span: n.Span, LHS: ToAST(n.Cond), RHS: ToAST(n.Body)}
+		if n.Else != nil {
+			node.Alt = &ASTNode{Kind: AST_Else, Span: n.ElseSpan, LHS: ToAST(n.Else)}
+		}
+
+		return node
+	case *WhileStmt:
+		return &ASTNode{Kind: AST_While, Span: n.Span, LHS: ToAST(n.Cond), RHS: ToAST(n.Body)}
+	case *ForStmt:
+		node := &ASTNode{Kind: AST_For, Span: n.Span, LHS: ToAST(n.Cond), RHS: ToAST(n.Body)}
+		if n.Clauses {
+			clauses := [][]*ASTNode{singleToAST(n.Init), singleToAST(n.Cond), singleToAST(n.Post)}
+			node.LHS = &ASTNode{Kind: AST_Group, Span: n.ClauseSpan, Params: clauses}
+		}
+
+		return node
+	case *ReturnStmt:
+		return &ASTNode{Kind: AST_Return, Span: n.Span, LHS: ToAST(n.Value)}
+	case *ExitStmt:
+		return &ASTNode{Kind: n.Op, Span: n.Span, LHS: ToAST(n.Code)}
+	case *Block:
+		if n == nil {
+			return nil
+		}
+
+		return &ASTNode{Kind: AST_Block, Span: n.Span, Children: stmtsToAST(n.Stmts)}
+	case *FuncDecl:
+		node := &ASTNode{Kind: AST_Function, Span: n.Span, Doc: n.Doc, Value: n.Name, Children: stmtsToAST(n.Body)}
+
+		for _, param := range n.Params {
+			node.Params = append(node.Params, []*ASTNode{ToAST(param.Name), ToAST(param.Type)})
+		}
+
+		if n.Result != nil {
+			node.RHS = &ASTNode{Kind: n.Result.Arrow, Span: n.Result.Span, LHS: ToAST(n.Result.Type), RHS: ToAST(n.Result.Second)}
+		}
+
+		return node
+	}
+
+	panic(fmt.Sprintf("ToAST of unknown node %T", n))
+}
+
+func stmtsToAST(stmts []Stmt) []*ASTNode {
+	nodes := []*ASTNode{}
+	for _, stmt := range stmts {
+		nodes = append(nodes, ToAST(stmt))
+	}
+
+	return nodes
+}
+
+func exprsToAST(exprs []Expr) []*ASTNode {
+	nodes := []*ASTNode{}
+	for _, expr := range exprs {
+		nodes = append(nodes, ToAST(expr))
+	}
+
+	return nodes
+}
+
+func groupToAST(exprs []Expr) [][]*ASTNode {
+	group := [][]*ASTNode{}
+	for _, expr := range exprs {
+		group = append(group, []*ASTNode{ToAST(expr)})
+	}
+
+	return group
+}
+
+// singleToAST puts an optional node in a slice, empty if it is nil.
+func singleToAST(n Node) []*ASTNode {
+	if node := ToAST(n); node != nil {
+		return []*ASTNode{node}
+	}
+
+	return []*ASTNode{}
+}
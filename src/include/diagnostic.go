@@ -0,0 +1,146 @@
+package include
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorBold   = "\033[1m"
+	colorRed    = "\033[1;31m"
+	colorYellow = "\033[1;33m"
+	colorBlue   = "\033[1;34m"
+	colorCyan   = "\033[1;36m"
+)
+
+// Error returns the diagnostic as a single line, e.g. for logs.
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s[E%03d]: %s", d.Span, d.Severity, d.Code, d.Message)
+}
+
+// Render writes the diagnostic in full, quoting the lines of src its spans
+// point at and underlining them. Colour escapes are only written if color is
+// set.
+func (d *Diagnostic) Render(w io.Writer, src string, color bool) {
+	paint := func(code, text string) string {
+		if !color {
+			return text
+		}
+
+		return code + text + colorReset
+	}
+
+	sevColor := map[Severity]string{
+		SEV_Error:   colorRed,
+		SEV_Warning: colorYellow,
+		SEV_Note:    colorCyan,
+	}[d.Severity]
+
+	fmt.Fprintf(w, "%s%s\n",
+		paint(sevColor, fmt.Sprintf("%s[E%03d]", d.Severity, d.Code)),
+		paint(colorBold, ": "+d.Message))
+
+	lines := strings.Split(src, "\n")
+
+	type mark struct {
+		Span    Span
+		Message string
+		Primary bool
+	}
+
+	marks := []mark{{d.Span, "", true}}
+	for _, label := range d.Labels {
+		marks = append(marks, mark{label.Span, label.Message, false})
+	}
+
+	marks = slices.DeleteFunc(marks, func(m mark) bool {
+		return m.Span.Start.Line < 1 || m.Span.Start.Line > len(lines)
+	})
+	slices.SortStableFunc(marks, func(a, b mark) int {
+		return a.Span.Start.Offset - b.Span.Start.Offset
+	})
+
+	gutter := 1
+	for _, m := range marks {
+		gutter = max(gutter, len(fmt.Sprint(m.Span.Start.Line)))
+	}
+	pad := strings.Repeat(" ", gutter)
+	bar := paint(colorBlue, "|")
+
+	if d.Span.File != "" || d.Span.Start.Line > 0 {
+		fmt.Fprintf(w, "%s%s %s\n", pad, paint(colorBlue, "-->"), d.Span)
+	}
+
+	if len(marks) > 0 {
+		fmt.Fprintf(w, "%s %s\n", pad, bar)
+	}
+
+	for i, m := range marks {
+		lineNum := m.Span.Start.Line
+		line := strings.TrimRight(lines[lineNum-1], "\r")
+
+		if i == 0 || marks[i-1].Span.Start.Line != lineNum {
+			if i > 0 && marks[i-1].Span.Start.Line < lineNum-1 {
+				fmt.Fprintf(w, "%s\n", paint(colorBlue, "..."))
+			}
+
+			fmt.Fprintf(w, "%s %s %s\n", paint(colorBlue, fmt.Sprintf("%*d", gutter, lineNum)), bar, line)
+		}
+
+		// Spans over several lines are underlined up to the end of their first.
+		// Columns count runes, and tabs are kept so the marks line up.
+		chars := []rune(line)
+		start := min(m.Span.Start.Col-1, len(chars))
+		width := len(chars) - start
+
+		indent := []rune(strings.Repeat(" ", start))
+		for j, char := range chars[:start] {
+			if char == '\t' {
+				indent[j] = '\t'
+			}
+		}
+
+		if m.Span.End.Line == lineNum {
+			width = min(width, m.Span.End.Col-m.Span.Start.Col)
+		}
+
+		underline := strings.Repeat("-", max(width, 1))
+		markColor := colorBlue
+		if m.Primary {
+			underline = strings.Repeat("^", max(width, 1))
+			markColor = sevColor
+		}
+
+		if m.Message != "" {
+			underline += " " + m.Message
+		}
+
+		fmt.Fprintf(w, "%s %s %s%s\n", pad, bar, string(indent), paint(markColor, underline))
+	}
+
+	if len(d.Notes) > 0 || len(d.Fixes) > 0 {
+		fmt.Fprintf(w, "%s %s\n", pad, bar)
+	}
+
+	for _, note := range d.Notes {
+		fmt.Fprintf(w, "%s %s %s\n", pad, paint(colorBlue, "="), paint(colorBold, "note: ")+note)
+	}
+
+	for _, fix := range d.Fixes {
+		fmt.Fprintf(w, "%s %s %s\n", pad, paint(colorBlue, "="), paint(colorCyan, "help: ")+fix.String())
+	}
+}
+
+func (fix Fix) String() string {
+	switch {
+	case fix.Span.Start.Offset == fix.Span.End.Offset:
+		return fmt.Sprintf("%s: insert `%s` at %s", fix.Message, fix.Replacement, fix.Span)
+	case fix.Replacement == "":
+		return fmt.Sprintf("%s: remove the code at %s", fix.Message, fix.Span)
+	default:
+		return fmt.Sprintf("%s: replace with `%s`", fix.Message, fix.Replacement)
+	}
+}
@@ -0,0 +1,82 @@
+package include
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	src := "x := 1\ny := x + \"a\"\n"
+	span := func(line, col, endCol, offset int) Span {
+		return Span{"test.wp", Position{line, col, offset}, Position{line, endCol, offset + endCol - col}}
+	}
+
+	diag := &Diagnostic{
+		Code:    41,
+		Message: "Mismatched types",
+		Span:    span(2, 10, 13, 16),
+		Labels:  []Label{{span(1, 1, 2, 0), "declared here"}},
+		Notes:   []string{"`x` is an int"},
+		Fixes:   []Fix{{span(2, 10, 13, 16), "1", "Use a number"}},
+	}
+
+	want := "error[E041]: Mismatched types\n" +
+		" --> test.wp:2:10\n" +
+		"  |\n" +
+		"1 | x := 1\n" +
+		"  | - declared here\n" +
+		"2 | y := x + \"a\"\n" +
+		"  |          ^^^\n" +
+		"  |\n" +
+		"  = note: `x` is an int\n" +
+		"  = help: Use a number: replace with `1`\n"
+
+	out := bytes.Buffer{}
+	diag.Render(&out, src, false)
+
+	if got := out.String(); got != want {
+		t.Errorf("Render:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRenderLexError(t *testing.T) {
+	src := "x := 3 @ 4"
+	_, _, diags := Lex("test.wp", src)
+	if len(diags) != 1 {
+		t.Fatalf("got %d diagnostics for `@`, want 1", len(diags))
+	}
+
+	want := "error[E022]: Invalid symbol: `@`\n" +
+		" --> test.wp:1:8\n" +
+		"  |\n" +
+		"1 | x := 3 @ 4\n" +
+		"  |        ^\n"
+
+	out := bytes.Buffer{}
+	diags[0].Render(&out, src, false)
+
+	if got := out.String(); got != want {
+		t.Errorf("Render:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRenderTabs(t *testing.T) {
+	src := "fn f() {\n\tx := \"é\" @ 1\n}"
+	_, _, diags := Lex("test.wp", src)
+	if len(diags) != 1 {
+		t.Fatalf("got %d diagnostics for `@`, want 1", len(diags))
+	}
+
+	want := "error[E022]: Invalid symbol: `@`\n" +
+		" --> test.wp:2:11\n" +
+		"  |\n" +
+		"2 | \tx := \"é\" @ 1\n" +
+		"  | \t         ^\n"
+
+	out := bytes.Buffer{}
+	diags[0].Render(&out, src, false)
+
+	if got := out.String(); got != want {
+		t.Errorf("Render:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,160 @@
+package include
+
+import (
+	"slices"
+	"strings"
+)
+
+// formatItem is a token or comment of the file being formatted.
+type formatItem struct {
+	Tok     Token
+	Text    string
+	Comment bool
+	Start   Position
+	End     Position
+}
+
+// Tokens that are never followed or preceded by a space
+var (
+	tightAfter  = []TokenKind{TOK_LParen, TOK_LBrack, TOK_Dot, TOK_Colon, TOK_Not, TOK_BNot}
+	tightBefore = []TokenKind{TOK_RParen, TOK_RBrack, TOK_Comma, TOK_Semi, TOK_Dot, TOK_Colon, TOK_Inc, TOK_Dec}
+)
+
+// Format lays out the source of a file that parsed without errors in the
+// standard style: a tab of indentation per open bracket, single spaces around
+// binary operators and after commas, and no more than one blank line in a
+// row. Line breaks and comments are kept where they were.
+func Format(file *File) string {
+	tokens, comments, _ := Lex(file.Name, file.Src)
+
+	items := []formatItem{}
+	for _, tok := range tokens {
+		if tok.Kind == TOK_Newline || tok.Kind == TOK_EOF {
+			continue
+		}
+
+		items = append(items, formatItem{Tok: tok, Text: file.Src[tok.Pos.Offset:tok.End.Offset], Start: tok.Pos, End: tok.End})
+	}
+
+	for _, comment := range comments {
+		items = append(items, formatItem{Text: comment.Text, Comment: true, Start: comment.Span.Start, End: comment.Span.End})
+	}
+
+	slices.SortFunc(items, func(a, b formatItem) int {
+		return a.Start.Offset - b.Start.Offset
+	})
+
+	out := strings.Builder{}
+	depth := 0
+
+	for i, item := range items {
+		closes := !item.Comment && slices.Contains([]TokenKind{TOK_RParen, TOK_RBrack, TOK_RBrace}, item.Tok.Kind)
+
+		if i > 0 {
+			prev := items[i-1]
+
+			if breaks := item.Start.Line - prev.End.Line; breaks > 0 {
+				if closes {
+					depth--
+					closes = false
+				}
+
+				out.WriteString(strings.Repeat("\n", min(breaks, 2)))
+				out.WriteString(strings.Repeat("\t", max(depth, 0)))
+			} else if spaced(items, i) {
+				out.WriteByte(' ')
+			}
+		}
+
+		out.WriteString(item.Text)
+
+		if closes {
+			depth--
+		} else if !item.Comment && slices.Contains([]TokenKind{TOK_LParen, TOK_LBrack, TOK_LBrace}, item.Tok.Kind) {
+			depth++
+		}
+	}
+
+	if out.Len() > 0 {
+		out.WriteByte('\n')
+	}
+
+	return out.String()
+}
+
+// spaced reports whether a space goes between items i-1 and i, which are on
+// the same line.
+func spaced(items []formatItem, i int) bool {
+	prev, cur := items[i-1], items[i]
+	gap := prev.End.Offset < cur.Start.Offset
+
+	switch {
+	case cur.Comment || prev.Comment:
+		return true
+	case slices.Contains(tightAfter, prev.Tok.Kind) || slices.Contains(tightBefore, cur.Tok.Kind):
+		return false
+	case (prev.Tok.Kind == TOK_TypeOp || prev.Tok.Kind == TOK_Sub) && isPrefix(items, i-1):
+		// `- -x` would lex as `--x`
+		return prev.Tok.Kind == TOK_Sub && strings.HasPrefix(cur.Text, "-")
+	case prev.Tok.Kind == TOK_LBrace || cur.Tok.Kind == TOK_RBrace:
+		// Both `{ return x }` and `{1, 2}` are fine
+		return gap
+	}
+
+	afterValue := slices.Contains([]TokenKind{TOK_Id, TOK_RParen, TOK_RBrack, TOK_String}, prev.Tok.Kind)
+
+	switch cur.Tok.Kind {
+	case TOK_LParen:
+		// A call
+		return !afterValue
+	case TOK_LBrack:
+		// An index, or a type after a name
+		if afterValue && prev.Tok.Kind != TOK_String {
+			return gap
+		}
+	case TOK_LBrace:
+		// The values of a list literal, after its `[N]T`, but not the body of
+		// a function returning one
+		if prev.Tok.Kind == TOK_Id && i > 1 && items[i-2].Tok.Kind == TOK_RBrack && !isReturnType(items, i-2) {
+			return false
+		}
+	case TOK_Id:
+		// The element type of `[]T`
+		if prev.Tok.Kind == TOK_RBrack {
+			return gap
+		}
+	}
+
+	return true
+}
+
+// isReturnType reports whether items[i] is part of the types after a
+// function's return arrow, found by going back over types and commas.
+func isReturnType(items []formatItem, i int) bool {
+	for ; i >= 0; i-- {
+		switch items[i].Tok.Kind {
+		case TOK_Id, TOK_Int, TOK_Comma, TOK_LBrack, TOK_RBrack:
+		case TOK_ReturnOnly, TOK_ReturnNil, TOK_ReturnErr, TOK_ReturnErrNil:
+			return true
+		default:
+			return false
+		}
+	}
+
+	return false
+}
+
+// isPrefix reports whether the operator at items[i] is a prefix one, i.e. it
+// doesn't follow a value.
+func isPrefix(items []formatItem, i int) bool {
+	if i == 0 {
+		return true
+	}
+
+	prev := items[i-1]
+	if prev.Comment || prev.End.Line < items[i].Start.Line {
+		return true
+	}
+
+	return !valueEnd(prev.Tok)
+}
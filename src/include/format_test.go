@@ -0,0 +1,52 @@
+package include
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"x:=1+2", "x := 1 + 2\n"},
+		{"fn f( a int,b int )->int{return a*b}", "fn f(a int, b int) -> int {return a * b}\n"},
+		{"fn f() {\nif x {\ny(1)\n}\n}", "fn f() {\n\tif x {\n\t\ty(1)\n\t}\n}\n"},
+		{"fn f() -> [3]int {\nreturn [3]int{1, 2, 3}\n}", "fn f() -> [3]int {\n\treturn [3]int{1, 2, 3}\n}\n"},
+		{"l := [3]int {1, 2, 3}\nm := l[0 : 2]", "l := [3]int{1, 2, 3}\nm := l[0:2]\n"},
+		{"x := :: y\nz := .! x", "x := ::y\nz := .!x\n"},
+		{"x := 1 // one\n/* two */ y := 2", "x := 1 // one\n/* two */ y := 2\n"},
+		{"x := \"a {1 /* c */} b\" // d", "x := \"a {1 /* c */} b\" // d\n"},
+		{"x := - 1\ny := x - 1", "x := -1\ny := x - 1\n"},
+		{"x := - -y\nz := - -128i8", "x := - -y\nz := - -128i8\n"},
+		{"fn f() -> int {\nreturn - 1\n}", "fn f() -> int {\n\treturn -1\n}\n"},
+		{"x := (-1, ::y, [2]int{-1, 1})", "x := (-1, ::y, [2]int{-1, 1})\n"},
+		{"x := 1\n\n\n\ny := 2", "x := 1\n\ny := 2\n"},
+	}
+
+	for _, test := range tests {
+		file := ParseString("test.wp", test.src, nil)
+		if len(file.Diags) > 0 {
+			t.Errorf("%q: unexpected %s", test.src, file.Diags[0].Message)
+			continue
+		}
+
+		got := Format(file)
+		if got != test.want {
+			t.Errorf("Format(%q):\n got %q\nwant %q", test.src, got, test.want)
+		}
+
+		// The output must parse to the same tree and be left as it is
+		formatted := ParseString("test.wp", got, nil)
+		if len(formatted.Diags) > 0 {
+			t.Errorf("Format(%q) doesn't parse: %s", test.src, formatted.Diags[0].Message)
+			continue
+		}
+
+		if Sexpr(formatted.Root) != Sexpr(file.Root) {
+			t.Errorf("Format(%q) changed the tree:\n got %s\nwant %s", test.src, Sexpr(formatted.Root), Sexpr(file.Root))
+		}
+
+		if again := Format(formatted); again != got {
+			t.Errorf("Format(%q) isn't stable:\n got %q\nthen %q", test.src, got, again)
+		}
+	}
+}
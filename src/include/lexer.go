@@ -0,0 +1,808 @@
+package include
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var keywords = []string{
+	"fn", "return", "exit",
+	"if", "else", "while", "for",
+	"true", "false", "nil",
+}
+
+// stmtEnds are the tokens a statement can end with. A newline after any
+// other token, e.g. a binary operator or a comma, continues the statement.
+var stmtEnds = []TokenKind{
+	TOK_Id, TOK_Int, TOK_Float, TOK_Binary, TOK_Octal, TOK_Hex, TOK_String, TOK_Char,
+	TOK_Inc, TOK_Dec, TOK_RParen, TOK_RBrace, TOK_RBrack, TOK_Bad,
+}
+
+var stmtEndKeywords = []string{"return", "exit", "true", "false", "nil"}
+
+// valueEnd reports whether tok can end a value, making an operator after it a
+// binary one, e.g. the `-` of `x - 1` but not of `return -1`.
+func valueEnd(tok Token) bool {
+	if tok.Kind == TOK_Keyword {
+		return slices.Contains([]string{"true", "false", "nil"}, tok.Value)
+	}
+
+	return slices.Contains(stmtEnds, tok.Kind)
+}
+
+var operators = map[string]TokenKind{
+	//====== Maths ======//
+	"+":  TOK_Add,
+	"-":  TOK_Sub,
+	"/":  TOK_Div,
+	"*":  TOK_Mul,
+	"^":  TOK_Pow,
+	"%":  TOK_Mod,
+	"++": TOK_Inc,
+	"--": TOK_Dec,
+
+	//====== Logic ======//
+	"&": TOK_And,
+	"|": TOK_Or,
+	"!": TOK_Not,
+
+	//====== Bitwise ======//
+	".&": TOK_BAnd,
+	".|": TOK_BOr,
+	".^": TOK_BXor,
+	".<": TOK_BLeft,
+	".>": TOK_BRight,
+	".!": TOK_BNot,
+
+	//====== Equality ======//
+	"==": TOK_Equal,
+	"!=": TOK_NotEqual,
+	">":  TOK_Greater,
+	"<":  TOK_Lesser,
+	">=": TOK_GreaterOrEqual,
+	"<=": TOK_LesserOrEqual,
+
+	//====== Assignment ======//
+	":=": TOK_Variable,
+	"#=": TOK_Constant,
+	"::": TOK_TypeOp,
+	"=":  TOK_Assign,
+
+	//====== Exits ======//
+	"<-": TOK_ExitCode,
+	"<!": TOK_ExitNow,
+
+	//====== Returns ======//
+	"->": TOK_ReturnOnly,
+	"~>": TOK_ReturnNil,
+	"!>": TOK_ReturnErr,
+	"?>": TOK_ReturnErrNil,
+
+	//====== Delimiters ======//
+	"(": TOK_LParen,
+	")": TOK_RParen,
+	"{": TOK_LBrace,
+	"}": TOK_RBrace,
+	"[": TOK_LBrack,
+	"]": TOK_RBrack,
+	":": TOK_Colon,
+	",": TOK_Comma,
+	";": TOK_Semi,
+}
+
+// Lex turns a whole source file into a token stream, always terminated by a
+// TOK_EOF token. Source that fails to lex becomes a TOK_Bad token with its
+// diagnostic in the returned list, so lexing always reaches the end.
+//
+// Like Go's semicolon insertion, a newline only becomes a TOK_Newline if it
+// could end a statement: after a token in stmtEnds and outside of any
+// parentheses or brackets. So expressions may be broken after an operator,
+// and lists and arguments may span lines.
+func Lex(file, src string) ([]Token, []Comment, []*Diagnostic) {
+	l := &Lexer{
+		File: file,
+		Src:  src,
+		Pos:  Position{Line: 1, Col: 1},
+	}
+
+	for {
+		line := l.Pos.Line
+		if err := l.skipSpace(); err != nil {
+			l.Diags = append(l.Diags, err)
+		}
+
+		// A block comment over several lines ends a statement like a newline
+		if l.Pos.Line > line && l.endsStmt() {
+			l.Tokens = append(l.Tokens, Token{Kind: TOK_Newline, Value: "\n", Pos: l.Pos, End: l.Pos})
+		}
+
+		start := l.Pos
+
+		tok, err := l.Next()
+		if err != nil {
+			l.Diags = append(l.Diags, err)
+			l.skipBad(start)
+			tok = l.token(TOK_Bad, start)
+		}
+
+		switch tok.Kind {
+		case TOK_Newline:
+			if !l.endsStmt() {
+				continue
+			}
+		case TOK_LParen, TOK_LBrack, TOK_LBrace:
+			l.Nesting = append(l.Nesting, tok.Kind)
+		case TOK_RParen, TOK_RBrack, TOK_RBrace:
+			l.close(tok.Kind)
+		}
+
+		l.Tokens = append(l.Tokens, tok)
+
+		if tok.Kind == TOK_EOF {
+			return l.Tokens, l.Comments, l.Diags
+		}
+	}
+}
+
+// Next reads the token starting at the current position, skipping any
+// whitespace and comments in front of it.
+func (l *Lexer) Next() (Token, *Diagnostic) {
+	if err := l.skipSpace(); err != nil {
+		return Token{}, err
+	}
+
+	start := l.Pos
+
+	if l.Pos.Offset >= len(l.Src) {
+		return Token{Kind: TOK_EOF, Pos: start, End: start}, nil
+	}
+
+	char := l.peek(0)
+
+	switch {
+	case char == '\n':
+		l.advance()
+		return l.token(TOK_Newline, start), nil
+	case unicode.IsLetter(char) || char == '_':
+		return l.lexWord(start), nil
+	case unicode.IsDigit(char):
+		return l.lexNumber(start)
+	case strings.ContainsRune("'\"`", char):
+		return l.lexString(start)
+	}
+
+	return l.lexOp(start)
+}
+
+// openers maps each closing bracket to the one it closes.
+var openers = map[TokenKind]TokenKind{
+	TOK_RParen: TOK_LParen,
+	TOK_RBrack: TOK_LBrack,
+	TOK_RBrace: TOK_LBrace,
+}
+
+// close pops the bracket closed by closer off Nesting, along with any left
+// unclosed inside it, so that after `{ f(1 }` newlines end statements again.
+// A closer without an opener closes the innermost bracket.
+func (l *Lexer) close(closer TokenKind) {
+	for i := len(l.Nesting) - 1; i >= 0; i-- {
+		if l.Nesting[i] == openers[closer] {
+			l.Nesting = l.Nesting[:i]
+			return
+		}
+	}
+
+	if len(l.Nesting) > 0 {
+		l.Nesting = l.Nesting[:len(l.Nesting)-1]
+	}
+}
+
+// endsStmt reports whether a newline after the last token ends a statement.
+func (l *Lexer) endsStmt() bool {
+	if len(l.Tokens) == 0 {
+		return false
+	}
+
+	if len(l.Nesting) > 0 && l.Nesting[len(l.Nesting)-1] != TOK_LBrace {
+		return false
+	}
+
+	last := l.Tokens[len(l.Tokens)-1]
+	if last.Kind == TOK_Keyword {
+		return slices.Contains(stmtEndKeywords, last.Value)
+	}
+
+	return slices.Contains(stmtEnds, last.Kind)
+}
+
+func (l *Lexer) lexWord(start Position) Token {
+	for l.Pos.Offset < len(l.Src) && isWordChar(l.peek(0)) {
+		l.advance()
+	}
+
+	tok := l.token(TOK_Id, start)
+	if slices.Contains(keywords, tok.Value) {
+		tok.Kind = TOK_Keyword
+	}
+
+	return tok
+}
+
+// numSuffixes are the width suffixes a numeric literal may end with, e.g.
+// `42u8` or `1.5f32`.
+var numSuffixes = []string{
+	"i8", "i16", "i32", "i64",
+	"u8", "u16", "u32", "u64",
+	"f32", "f64",
+}
+
+// numBases maps the prefix after a leading `0` to the kind of literal it starts
+// and a description of the digits it takes.
+var numBases = map[rune]struct {
+	Kind   TokenKind
+	Digits string
+	Expect string
+}{
+	'x': {TOK_Hex, "0123456789abcdefABCDEF", "`0-9`, `a-f` or `A-F`"},
+	'o': {TOK_Octal, "01234567", "`0-7`"},
+	'b': {TOK_Binary, "01", "`0` or `1`"},
+}
+
+// lexNumber lexes a numeric literal:
+//
+//	1_000   an integer, with `_` between digits
+//	1.5e-3  a float, with an optional fraction and exponent
+//	0xF3    a hexadecimal, octal (`0o`) or binary (`0b`) integer
+//
+// Any of these may end with one of numSuffixes. The token's Value is the
+// literal without `_` or its suffix, which is kept in Suffix.
+func (l *Lexer) lexNumber(start Position) (Token, *Diagnostic) {
+	kind := TOK_Int
+	digits, expect := "0123456789", "`0-9`"
+
+	if base, ok := numBases[l.peek(1)]; ok && l.peek(0) == '0' {
+		kind, digits, expect = base.Kind, base.Digits, base.Expect
+		l.advance()
+		l.advance()
+
+		if !strings.ContainsRune(digits, l.peek(0)) {
+			err := fmt.Sprintf("Expected digits after `%s`", l.Src[start.Offset:l.Pos.Offset])
+			return Token{}, &Diagnostic{Code: 20, Message: err, Span: l.spanFrom(start)}
+		}
+	}
+
+	value := strings.Builder{}
+	if err := l.lexDigits(digits, &value); err != nil {
+		return Token{}, err
+	}
+
+	// A dot not followed by a digit belongs to the next operator (`1.&2`)
+	if kind == TOK_Int && l.peek(0) == '.' && unicode.IsDigit(l.peek(1)) {
+		kind = TOK_Float
+		value.WriteRune(l.advance())
+
+		if err := l.lexDigits(digits, &value); err != nil {
+			return Token{}, err
+		}
+	}
+
+	if (kind == TOK_Int || kind == TOK_Float) && (l.peek(0) == 'e' || l.peek(0) == 'E') {
+		kind = TOK_Float
+		value.WriteRune(l.advance())
+
+		if l.peek(0) == '+' || l.peek(0) == '-' {
+			value.WriteRune(l.advance())
+		}
+
+		if !unicode.IsDigit(l.peek(0)) {
+			err := "Expected digits in float exponent"
+			return Token{}, &Diagnostic{Code: 21, Message: err, Span: l.spanFrom(start)}
+		}
+
+		if err := l.lexDigits(digits, &value); err != nil {
+			return Token{}, err
+		}
+	}
+
+	suffix := ""
+	if strings.ContainsRune("iuf", l.peek(0)) {
+		suffixStart := l.Pos
+		for l.Pos.Offset < len(l.Src) && isWordChar(l.peek(0)) {
+			l.advance()
+		}
+
+		suffix = l.Src[suffixStart.Offset:l.Pos.Offset]
+		span := l.spanFrom(suffixStart)
+
+		switch {
+		case !slices.Contains(numSuffixes, suffix):
+			err := fmt.Sprintf("Invalid suffix `%s` on %s, expected one of %s", suffix, strings.ToLower(kind.String()), strings.Join(numSuffixes, ", "))
+			return Token{}, &Diagnostic{Code: 20, Message: err, Span: span}
+		case suffix[0] == 'f' && kind != TOK_Int && kind != TOK_Float:
+			err := fmt.Sprintf("Float suffix `%s` on %s", suffix, strings.ToLower(kind.String()))
+			return Token{}, &Diagnostic{Code: 20, Message: err, Span: span}
+		case suffix[0] == 'f':
+			kind = TOK_Float
+		case kind == TOK_Float:
+			err := fmt.Sprintf("Integer suffix `%s` on float", suffix)
+			return Token{}, &Diagnostic{Code: 21, Message: err, Span: span}
+		}
+	}
+
+	if char := l.peek(0); l.Pos.Offset < len(l.Src) && isWordChar(char) {
+		err := fmt.Sprintf("Invalid char in %s, expected %s: `%s`", strings.ToLower(kind.String()), expect, string(char))
+		if kind == TOK_Float {
+			return Token{}, &Diagnostic{Code: 21, Message: err, Span: l.charSpan()}
+		}
+
+		return Token{}, &Diagnostic{Code: 20, Message: err, Span: l.charSpan()}
+	}
+
+	tok := l.token(kind, start)
+	tok.Raw = tok.Value
+	tok.Value = value.String()
+	if kind != TOK_Int && kind != TOK_Float {
+		tok.Value = l.Src[start.Offset:start.Offset+2] + tok.Value
+	}
+	tok.Suffix = suffix
+
+	return tok, nil
+}
+
+// lexDigits writes the run of digits at the current position to value,
+// skipping the `_` allowed between them.
+func (l *Lexer) lexDigits(digits string, value *strings.Builder) *Diagnostic {
+	for l.Pos.Offset < len(l.Src) {
+		char := l.peek(0)
+
+		if char == '_' {
+			prev := rune(l.Src[l.Pos.Offset-1])
+			if !strings.ContainsRune(digits, prev) || !strings.ContainsRune(digits, l.peek(1)) {
+				err := "Expected `_` to be between digits"
+				return &Diagnostic{Code: 20, Message: err, Span: l.charSpan()}
+			}
+
+			l.advance()
+			continue
+		}
+
+		if !strings.ContainsRune(digits, char) {
+			return nil
+		}
+
+		value.WriteRune(l.advance())
+	}
+
+	return nil
+}
+
+// lexString lexes a string or char literal. The token's Value is the decoded
+// literal and its Raw the source text, quotes included:
+//
+//	"..."  a string, with escapes and embedded `{...}` expressions
+//	'.'    a char, a single rune with escapes
+//	`...`  a raw string, without escapes and possibly spanning lines
+//
+// If a string embeds expressions, its pieces are kept in the token's Parts.
+func (l *Lexer) lexString(start Position) (Token, *Diagnostic) {
+	quote := l.peek(0)
+	value := strings.Builder{}
+	parts := []StringPart{}
+
+	var escapeErr *Diagnostic
+
+	// Move over the first quote
+	l.advance()
+
+	for l.peek(0) != quote {
+		char := l.peek(0)
+
+		if l.Pos.Offset >= len(l.Src) || char == '\n' && quote != '`' {
+			err := "Missing string terminator"
+			if quote == '\'' {
+				err = "Missing char terminator"
+			}
+
+			return Token{}, &Diagnostic{
+				Code:    23,
+				Message: err,
+				Span:    l.spanFrom(start),
+				Fixes: []Fix{{
+					Span:        l.spanFrom(l.Pos),
+					Replacement: string(quote),
+					Message:     "close the literal",
+				}},
+			}
+		}
+
+		if char == '{' && quote == '"' {
+			expr, err := l.lexEmbedded()
+			if err != nil {
+				return Token{}, err
+			}
+
+			parts = append(parts, StringPart{Text: value.String()}, StringPart{Expr: expr})
+			value.Reset()
+			continue
+		}
+
+		if char == '\\' && quote != '`' {
+			decoded, err := l.lexEscape(quote)
+			if err != nil && escapeErr == nil {
+				escapeErr = err
+			}
+
+			value.WriteRune(decoded)
+			continue
+		}
+
+		value.WriteRune(char)
+		l.advance()
+	}
+
+	// Move over the last quote
+	l.advance()
+
+	// Report bad escapes only now, so the rest of the literal isn't lexed as code
+	if escapeErr != nil {
+		return Token{}, escapeErr
+	}
+
+	tok := l.token(TOK_String, start)
+	tok.Raw = tok.Value
+	tok.Value = value.String()
+
+	if len(parts) > 0 {
+		tok.Parts = append(parts, StringPart{Text: value.String()})
+		tok.Value = ""
+
+		for _, part := range tok.Parts {
+			tok.Value += part.Text
+		}
+	}
+
+	if quote == '\'' {
+		tok.Kind = TOK_Char
+
+		if utf8.RuneCountInString(tok.Value) != 1 {
+			err := fmt.Sprintf("Expected a single character in char literal, found %d", utf8.RuneCountInString(tok.Value))
+			return Token{}, &Diagnostic{
+				Code:    34,
+				Message: err,
+				Span:    l.spanFrom(start),
+				Fixes: []Fix{{
+					Span:        l.spanFrom(start),
+					Replacement: strconv.Quote(tok.Value),
+					Message:     "use a string",
+				}},
+			}
+		}
+	}
+
+	return tok, nil
+}
+
+var escapes = map[rune]rune{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'\\': '\\',
+	'"':  '"',
+	'\'': '\'',
+	'{':  '{',
+	'}':  '}',
+}
+
+// lexEmbedded lexes the expression embedded in a string between `{` and the
+// matching `}`, both of which it moves over.
+func (l *Lexer) lexEmbedded() ([]Token, *Diagnostic) {
+	open := l.charSpan()
+	l.advance()
+
+	sub := &Lexer{
+		File:    l.File,
+		Src:     l.Src,
+		Pos:     l.Pos,
+		Nesting: []TokenKind{TOK_LParen},
+	}
+
+	for depth := 0; ; {
+		tok, err := sub.Next()
+		if err != nil {
+			l.Pos = sub.Pos
+			return nil, err
+		}
+
+		switch tok.Kind {
+		case TOK_LBrace:
+			depth++
+		case TOK_RBrace:
+			depth--
+		case TOK_Newline, TOK_EOF:
+			l.Pos = sub.Pos
+			err := "Missing `}` after embedded expression"
+			return nil, &Diagnostic{
+				Code:    23,
+				Message: err,
+				Span:    sub.spanFrom(tok.Pos),
+				Labels:  []Label{{open, "expression opened here"}},
+				Notes:   []string{"use `\\{` for a literal `{`"},
+			}
+		}
+
+		if depth < 0 {
+			// Its comments stay in the string's source, not the comment table
+			l.Pos = sub.Pos
+			return append(sub.Tokens, Token{Kind: TOK_EOF, Pos: tok.Pos, End: tok.Pos}), nil
+		}
+
+		sub.Tokens = append(sub.Tokens, tok)
+	}
+}
+
+// lexEscape decodes the escape sequence at the current position, one of the
+// runes in escapes or `\u{...}` with the hex code point of any rune.
+func (l *Lexer) lexEscape(quote rune) (rune, *Diagnostic) {
+	start := l.Pos
+
+	// Move over the backslash
+	l.advance()
+
+	char := l.peek(0)
+	if char == '\n' || l.Pos.Offset >= len(l.Src) {
+		err := "Unfinished escape sequence"
+		return utf8.RuneError, &Diagnostic{Code: 35, Message: err, Span: l.spanFrom(start)}
+	}
+
+	l.advance()
+
+	if decoded, ok := escapes[char]; ok {
+		return decoded, nil
+	}
+
+	if char != 'u' {
+		err := fmt.Sprintf("Invalid escape sequence `\\%s`", string(char))
+		return utf8.RuneError, &Diagnostic{
+			Code:    35,
+			Message: err,
+			Span:    l.spanFrom(start),
+			Notes:   []string{"valid escapes are `\\n`, `\\t`, `\\r`, `\\0`, `\\\\`, `\\\"`, `\\'`, `\\{`, `\\}` and `\\u{...}`"},
+		}
+	}
+
+	if l.peek(0) != '{' {
+		err := "Expected `{` after `\\u`"
+		return utf8.RuneError, &Diagnostic{Code: 35, Message: err, Span: l.spanFrom(start)}
+	}
+	l.advance()
+
+	digits := l.Pos.Offset
+	for l.Pos.Offset < len(l.Src) && strings.ContainsRune("0123456789abcdefABCDEF", l.peek(0)) {
+		l.advance()
+	}
+
+	code, err := strconv.ParseUint(l.Src[digits:l.Pos.Offset], 16, 32)
+
+	if l.peek(0) != '}' || err != nil || !utf8.ValidRune(rune(code)) {
+		for l.Pos.Offset < len(l.Src) && !strings.ContainsRune("}\n", l.peek(0)) && l.peek(0) != quote {
+			l.advance()
+		}
+
+		if l.peek(0) == '}' {
+			l.advance()
+		}
+
+		err := "Invalid unicode escape, expected the hex code point of a character in `\\u{...}`"
+		return utf8.RuneError, &Diagnostic{Code: 35, Message: err, Span: l.spanFrom(start)}
+	}
+	l.advance()
+
+	return rune(code), nil
+}
+
+func (l *Lexer) lexOp(start Position) (Token, *Diagnostic) {
+	rest := l.Src[l.Pos.Offset:]
+
+	for _, size := range []int{2, 1} {
+		if len(rest) < size {
+			continue
+		}
+
+		if kind, ok := operators[rest[:size]]; ok {
+			for range size {
+				l.advance()
+			}
+
+			return l.token(kind, start), nil
+		}
+	}
+
+	switch rest[0] {
+	case '.':
+		// A dot before a name accesses a member, e.g. `list.len()`
+		if next := l.peek(1); unicode.IsLetter(next) || next == '_' {
+			l.advance()
+			return l.token(TOK_Dot, start), nil
+		}
+
+		if len(rest) < 2 || unicode.IsSpace(rune(rest[1])) {
+			err := "Expected operator after bitwise initializer"
+			return Token{}, &Diagnostic{
+				Code:    25,
+				Message: err,
+				Span:    l.charSpan(),
+				Notes:   []string{"bitwise operators are `.&`, `.|`, `.^`, `.<`, `.>` and `.!`"},
+			}
+		}
+
+		err := fmt.Sprintf("Invalid operator: `%s`", rest[:2])
+		l.advance()
+		return Token{}, &Diagnostic{
+			Code:    25,
+			Message: err,
+			Span:    Span{File: l.File, Start: start, End: l.charSpan().End},
+			Notes:   []string{"bitwise operators are `.&`, `.|`, `.^`, `.<`, `.>` and `.!`"},
+		}
+	}
+
+	err := fmt.Sprintf("Invalid symbol: `%s`", string(l.peek(0)))
+	return Token{}, &Diagnostic{Code: 22, Message: err, Span: l.charSpan()}
+}
+
+// skipSpace moves over whitespace and `//` comments, but not over newlines as
+// they end statements.
+func (l *Lexer) skipSpace() *Diagnostic {
+	for l.Pos.Offset < len(l.Src) {
+		char := l.peek(0)
+
+		if char == '/' && l.peek(1) == '/' {
+			l.lexLineComment()
+		} else if char == '/' && l.peek(1) == '*' {
+			if err := l.lexBlockComment(); err != nil {
+				return err
+			}
+		} else if char != '\n' && unicode.IsSpace(char) {
+			l.advance()
+		} else {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// lexLineComment records the `//` or `///` comment at the current position,
+// up to the end of the line.
+func (l *Lexer) lexLineComment() {
+	start := l.Pos
+	kind := COM_Line
+	if l.peek(2) == '/' && l.peek(3) != '/' {
+		kind = COM_Doc
+	}
+
+	for l.Pos.Offset < len(l.Src) && l.peek(0) != '\n' {
+		l.advance()
+	}
+
+	l.Comments = append(l.Comments, Comment{
+		Kind: kind,
+		Text: strings.TrimRight(l.Src[start.Offset:l.Pos.Offset], "\r"),
+		Span: l.spanFrom(start),
+	})
+}
+
+// lexBlockComment records the `/* */` comment at the current position. Block
+// comments nest, so `/* a /* b */ c */` is a single comment.
+func (l *Lexer) lexBlockComment() *Diagnostic {
+	start := l.Pos
+	opens := []Position{}
+
+	for l.Pos.Offset < len(l.Src) {
+		switch {
+		case l.peek(0) == '/' && l.peek(1) == '*':
+			opens = append(opens, l.Pos)
+			l.advance()
+		case l.peek(0) == '*' && l.peek(1) == '/':
+			opens = opens[:len(opens)-1]
+			l.advance()
+		}
+
+		l.advance()
+
+		if len(opens) == 0 {
+			l.Comments = append(l.Comments, Comment{
+				Kind: COM_Block,
+				Text: l.Src[start.Offset:l.Pos.Offset],
+				Span: l.spanFrom(start),
+			})
+
+			return nil
+		}
+	}
+
+	open := opens[len(opens)-1]
+	err := "Missing `*/` after block comment"
+	return &Diagnostic{
+		Code:    23,
+		Message: err,
+		Span:    Span{File: l.File, Start: open, End: Position{Line: open.Line, Col: open.Col + 2, Offset: open.Offset + 2}},
+	}
+}
+
+// skipBad moves past the rest of a word that failed to lex, and at least one
+// rune, so lexing resumes on the next token.
+func (l *Lexer) skipBad(start Position) {
+	if l.Pos.Offset == start.Offset && l.Pos.Offset < len(l.Src) {
+		l.advance()
+	}
+
+	for l.Pos.Offset < len(l.Src) && isWordChar(l.peek(0)) {
+		l.advance()
+	}
+}
+
+// peek returns the rune `ahead` runes past the current position, or 0 past
+// the end of the source.
+func (l *Lexer) peek(ahead int) rune {
+	offset := l.Pos.Offset
+
+	for ; ahead > 0 && offset < len(l.Src); ahead-- {
+		_, size := utf8.DecodeRuneInString(l.Src[offset:])
+		offset += size
+	}
+
+	if offset >= len(l.Src) {
+		return 0
+	}
+
+	char, _ := utf8.DecodeRuneInString(l.Src[offset:])
+	return char
+}
+
+func (l *Lexer) advance() rune {
+	char, size := utf8.DecodeRuneInString(l.Src[l.Pos.Offset:])
+	l.Pos.Offset += size
+
+	if char == '\n' {
+		l.Pos.Line++
+		l.Pos.Col = 1
+	} else {
+		l.Pos.Col++
+	}
+
+	return char
+}
+
+// charSpan returns the span of the rune at the current position.
+func (l *Lexer) charSpan() Span {
+	end := l.Pos
+	if end.Offset < len(l.Src) {
+		_, size := utf8.DecodeRuneInString(l.Src[end.Offset:])
+		end.Offset += size
+		end.Col++
+	}
+
+	return Span{File: l.File, Start: l.Pos, End: end}
+}
+
+func (l *Lexer) spanFrom(start Position) Span {
+	return Span{File: l.File, Start: start, End: l.Pos}
+}
+
+func (l *Lexer) token(kind TokenKind, start Position) Token {
+	return Token{
+		Kind:  kind,
+		Value: l.Src[start.Offset:l.Pos.Offset],
+		Pos:   start,
+		End:   l.Pos,
+	}
+}
+
+func isWordChar(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsDigit(char) || char == '_'
+}
@@ -0,0 +1,138 @@
+package include
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// tokens lists the kind and value of each token of src but the final EOF,
+// with the suffix of numbers after a slash.
+func tokens(src string) (string, []*Diagnostic) {
+	toks, _, diags := Lex("test.wp", src)
+
+	out := []string{}
+	for _, tok := range toks {
+		if tok.Kind == TOK_EOF {
+			break
+		}
+
+		item := fmt.Sprintf("%s %q", tok.Kind, tok.Value)
+		if tok.Suffix != "" {
+			item += "/" + tok.Suffix
+		}
+
+		out = append(out, item)
+	}
+
+	return strings.Join(out, ", "), diags
+}
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"x := 1", "Identifier \"x\", `:=` \":=\", Integer \"1\""},
+		{"fn main() {}", "Keyword \"fn\", Identifier \"main\", `(` \"(\", `)` \")\", `{` \"{\", `}` \"}\""},
+		{"0xF3 0b101 3.25", "Hexadecimal \"0xF3\", Binary \"0b101\", Float \"3.25\""},
+		{"1", "Integer \"1\""},
+		{"0x1F 0o17 0b1", "Hexadecimal \"0x1F\", Octal \"0o17\", Binary \"0b1\""},
+		{"1_000 2.5e3 7f32 9u8", "Integer \"1000\", Float \"2.5e3\", Float \"7\"/f32, Integer \"9\"/u8"},
+		{"0xFF_FFi64 1e-3", "Hexadecimal \"0xFFFF\"/i64, Float \"1e-3\""},
+		{"limit #= 10", "Identifier \"limit\", `#=` \"#=\", Integer \"10\""},
+		{"a .& .!b", "Identifier \"a\", `.&` \".&\", `.!` \".!\", Identifier \"b\""},
+		{"a<-1", "Identifier \"a\", `<-` \"<-\", Integer \"1\""},
+		{"x ?> y", "Identifier \"x\", `?>` \"?>\", Identifier \"y\""},
+		{"\"hi\"", "String \"hi\""},
+		{"'x' \"it's\"", "Character \"x\", String \"it's\""},
+		{`"a\tb\"c\u{e9}"`, "String \"a\\tb\\\"c\u00e9\""},
+		{"`a\\n\nb`", "String \"a\\\\n\\nb\""},
+		{`'\''`, "Character \"'\""},
+		{"a\nb", "Identifier \"a\", Newline \"\\n\", Identifier \"b\""},
+		{"a // note\nb", "Identifier \"a\", Newline \"\\n\", Identifier \"b\""},
+		{"a /* x /* y */ z */ b", "Identifier \"a\", Identifier \"b\""},
+	}
+
+	for _, test := range tests {
+		got, diags := tokens(test.src)
+		if len(diags) > 0 {
+			t.Errorf("Lex(%q): unexpected %s", test.src, diags[0].Message)
+		}
+
+		if got != test.want {
+			t.Errorf("Lex(%q):\n got %s\nwant %s", test.src, got, test.want)
+		}
+	}
+}
+
+func TestLexPositions(t *testing.T) {
+	toks, _, diags := Lex("test.wp", "x := 1\n  yz")
+	if len(diags) > 0 {
+		t.Fatal(diags[0].Message)
+	}
+
+	want := []Position{{1, 1, 0}, {1, 3, 2}, {1, 6, 5}, {1, 7, 6}, {2, 3, 9}, {2, 5, 11}}
+	for i, tok := range toks {
+		if tok.Pos != want[i] {
+			t.Errorf("token %d (%s) at %v, want %v", i, tok.Kind, tok.Pos, want[i])
+		}
+	}
+}
+
+func TestLexComments(t *testing.T) {
+	_, comments, diags := Lex("test.wp", "// line\nx := 1 /* a /* b */ */\n/// doc\nfn f() {}\ny := \"a {1 /* c */} b\"")
+	if len(diags) > 0 {
+		t.Fatal(diags[0].Message)
+	}
+
+	want := []Comment{
+		{COM_Line, "// line", Span{"test.wp", Position{1, 1, 0}, Position{1, 8, 7}}},
+		{COM_Block, "/* a /* b */ */", Span{"test.wp", Position{2, 8, 15}, Position{2, 23, 30}}},
+		{COM_Doc, "/// doc", Span{"test.wp", Position{3, 1, 31}, Position{3, 8, 38}}},
+	}
+
+	if len(comments) != len(want) {
+		t.Fatalf("got %d comments, want %d: %v", len(comments), len(want), comments)
+	}
+
+	for i, comment := range comments {
+		if comment != want[i] {
+			t.Errorf("comment %d is %v, want %v", i, comment, want[i])
+		}
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		code int
+	}{
+		{"3 @ 4", 22},
+		{"x := \"abc", 23},
+		{"x := 'a", 23},
+		{"'ab'", 34},
+		{"/* open", 23},
+		{"/* a /* b */", 23},
+		{`"a\qb"`, 35},
+		{`"\u{110000}"`, 35},
+		{`"\u41"`, 35},
+		{"0b102", 20},
+		{"0xFG", 20},
+		{"9q", 20},
+		{"1.5x", 21},
+		{"1_", 20},
+		{"1__0", 20},
+		{"0o8", 20},
+		{"1e", 21},
+		{"1.5u8", 21},
+		{"a .+ b", 25},
+	}
+
+	for _, test := range tests {
+		_, diags := tokens(test.src)
+		if len(diags) == 0 || diags[0].Code != test.code {
+			t.Errorf("Lex(%q): got %v, want E%03d", test.src, diags, test.code)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package include
+
+import (
+	"go/constant"
+	"strconv"
+)
+
+// Lower rewrites the tree in place into the simpler forms code generation
+// expects. For now that turns interpolated strings into concatenations, so
+// `"a {x} b"` becomes `"a " + x :: string + " b"`. info is the Info from
+// Check, and gets the types and conversions of the nodes made.
+func Lower(node *ASTNode, info *Info) {
+	Walk(node, nil, func(c *Cursor) bool {
+		if c.Node().Kind == AST_Interp {
+			c.Replace(lowerInterp(c.Node(), info))
+		}
+
+		return true
+	})
+}
+
+// lowerInterp folds the parts of node into a chain of `+`. A string only lexes
+// as interpolated with an embedded expression in it, so there is always a part.
+func lowerInterp(node *ASTNode, info *Info) *ASTNode {
+	var result *ASTNode
+	str := Typ[TYP_String]
+
+	for _, part := range node.Children {
+		if part.Kind != AST_String {
+			name := &ASTNode{Kind: AST_Id, Value: "string", Span: part.Span}
+			info.Uses[name] = Universe.Lookup("string")
+
+			cast := &ASTNode{Kind: AST_TypeCast, LHS: part, RHS: name, Span: part.Span}
+			info.Types[cast] = str
+			info.Conversions[cast] = ConversionOf(info.Types[part], str)
+			part = cast
+		}
+
+		if result == nil {
+			result = part
+			continue
+		}
+
+		result = &ASTNode{
+			Kind: AST_Add,
+			LHS:  result,
+			RHS:  part,
+			Span: node.Span,
+		}
+		info.Types[result] = str
+	}
+
+	return result
+}
+
+// InlineConstants replaces every expression the checker found a constant
+// value for with a literal of that value, e.g. `limit * 2` with `20` after
+// `limit #= 10`, and removes the `#=` declarations, so constants cost nothing
+// at run time. info is updated to match. Negative integers keep their two's
+// complement in Int, and types become an AST_TypeValue.
+func InlineConstants(node *ASTNode, info *Info) {
+	Walk(node, func(c *Cursor) bool {
+		node := c.Node()
+
+		if node.Kind == AST_Constant && c.Index() >= 0 {
+			c.Delete()
+			return false
+		}
+
+		val, ok := info.Values[node]
+		if !ok {
+			return true
+		}
+
+		lit := constLiteral(val, node.Span)
+		if isBasic(info.Types[node], TYP_Type) {
+			// The value of `::x` is kept as the type's name, but isn't a string
+			lit = &ASTNode{Kind: AST_TypeValue, Value: constant.StringVal(val), Span: node.Span}
+		}
+
+		if lit == nil {
+			return true
+		}
+
+		info.Types[lit] = info.Types[node]
+		info.Values[lit] = val
+		c.Replace(lit)
+		return false
+	}, nil)
+}
+
+// constLiteral makes a literal node of a constant value.
+func constLiteral(val constant.Value, span Span) *ASTNode {
+	lit := &ASTNode{Span: span}
+
+	switch val.Kind() {
+	case constant.Bool:
+		lit.Kind = AST_False
+		if constant.BoolVal(val) {
+			lit.Kind = AST_True
+		}
+
+		return lit
+	case constant.String:
+		lit.Kind = AST_String
+		lit.Value = constant.StringVal(val)
+		lit.Raw = strconv.Quote(lit.Value)
+		return lit
+	case constant.Int:
+		lit.Kind = AST_Int
+		lit.Value = val.ExactString()
+
+		if n, ok := constant.Uint64Val(val); ok {
+			lit.Int = n
+		} else if n, ok := constant.Int64Val(val); ok {
+			lit.Int = uint64(n)
+		} else {
+			return nil
+		}
+	case constant.Float:
+		lit.Kind = AST_Float
+		lit.Float, _ = constant.Float64Val(val)
+		lit.Value = strconv.FormatFloat(lit.Float, 'g', -1, 64)
+	default:
+		return nil
+	}
+
+	lit.Raw = lit.Value
+	return lit
+}
+
+// LowerCasts removes the `::` casts that convert nothing, leaving the
+// operand in their place. The others are left for code generation, which
+// finds what each does in info.Conversions.
+func LowerCasts(node *ASTNode, info *Info) {
+	Walk(node, nil, func(c *Cursor) bool {
+		node := c.Node()
+		if conv, ok := info.Conversions[node]; ok && conv == CNV_None {
+			c.Replace(node.LHS)
+		}
+
+		return true
+	})
+}
@@ -0,0 +1,52 @@
+package include
+
+import "testing"
+
+func TestLower(t *testing.T) {
+	file, info, diags := checkSrc(t, "x := 1\ns := \"a {x} b\"")
+	if len(diags) > 0 {
+		t.Fatal(diags[0].Message)
+	}
+
+	Lower(file.Root, info)
+
+	rhs := file.Root.Children[1].RHS
+	want := `(add (add (string "a ") (type-cast (identifier "x") (identifier "string"))) (string " b"))`
+	if got := Sexpr(rhs); got != want {
+		t.Fatalf("lowered to:\n got %s\nwant %s", got, want)
+	}
+
+	for _, node := range []*ASTNode{rhs, rhs.LHS, rhs.LHS.RHS} {
+		if typ := info.Types[node]; typ != Typ[TYP_String] {
+			t.Errorf("%s is `%v`, want `string`", Sexpr(node), typ)
+		}
+	}
+
+	if conv := info.Conversions[rhs.LHS.RHS]; conv != CNV_Format {
+		t.Errorf("the cast of `x` does %v, want %v", conv, CNV_Format)
+	}
+}
+
+func TestLowerCasts(t *testing.T) {
+	file, info, diags := checkSrc(t, "n := 5u8\nname := \"wisp\"\ns := \"{name} {n}\"")
+	if len(diags) > 0 {
+		t.Fatal(diags[0].Message)
+	}
+
+	Lower(file.Root, info)
+	LowerCasts(file.Root, info)
+
+	rhs := file.Root.Children[2].RHS
+	want := `(add (add (identifier "name") (string " ")) (type-cast (identifier "n") (identifier "string")))`
+	if got := Sexpr(rhs); got != want {
+		t.Fatalf("lowered to:\n got %s\nwant %s", got, want)
+	}
+
+	if conv := info.Conversions[rhs.RHS]; conv != CNV_Format {
+		t.Errorf("the cast of `n` does %v, want %v", conv, CNV_Format)
+	}
+
+	if typ := info.Types[rhs]; typ != Typ[TYP_String] {
+		t.Errorf("the concatenation is `%v`, want `string`", typ)
+	}
+}
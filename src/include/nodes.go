@@ -0,0 +1,308 @@
+package include
+
+// The typed tree gives every kind of node its own struct, with named fields
+// in place of the LHS, RHS, Alt, Children and Params of an ASTNode. FromAST
+// and ToAST convert between the two while passes move over.
+
+// Node is any node of the typed tree.
+type Node interface {
+	NodeSpan() Span
+}
+
+// Expr is a node that has a value. Types, such as `[]int`, are expressions
+// too.
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// Stmt is a node that can stand on its own in a block.
+type Stmt interface {
+	Node
+	stmtNode()
+}
+
+//====== Expressions ======//
+
+// BadNode stands in for source that failed to parse, as an expression or a
+// statement.
+type BadNode struct {
+	Span Span
+}
+
+// Ident is a name, of a value or a type.
+type Ident struct {
+	Span Span
+	Name string
+}
+
+// Literal is a number, string, char, `true`, `false`, `nil` or an inlined
+// type value. Kind is the AST kind of the literal, e.g. AST_Hex.
+type Literal struct {
+	Span   Span
+	Kind   ASTKind
+	Value  string
+	Raw    string
+	Suffix string
+	Int    uint64
+	Float  float64
+}
+
+// InterpString is a string with embedded expressions. Its Parts alternate
+// between AST_String literals and the expressions.
+type InterpString struct {
+	Span  Span
+	Value string
+	Raw   string
+	Parts []Expr
+}
+
+// UnaryExpr is `!X`, `.!X`, `-X` or `::X`, with Op one of AST_Not, AST_BNot,
+// AST_Neg and AST_TypeOf.
+type UnaryExpr struct {
+	Span Span
+	Op   ASTKind
+	X    Expr
+}
+
+// BinaryExpr is `X op Y` for any binary operator but `::`.
+type BinaryExpr struct {
+	Span Span
+	Op   ASTKind
+	X    Expr
+	Y    Expr
+}
+
+// CastExpr is `X :: Type`.
+type CastExpr struct {
+	Span Span
+	X    Expr
+	Type Expr
+}
+
+// CallExpr is `Fn(Args...)`.
+type CallExpr struct {
+	Span Span
+	Fn   Expr
+	Args []Expr
+}
+
+// MemberExpr is `X.Name`.
+type MemberExpr struct {
+	Span Span
+	X    Expr
+	Name string
+}
+
+// IndexExpr is `X[Index]`.
+type IndexExpr struct {
+	Span  Span
+	X     Expr
+	Index Expr
+}
+
+// SliceExpr is `X[Lo:Hi]`, where either bound may be nil.
+type SliceExpr struct {
+	Span Span
+	X    Expr
+	Lo   Expr
+	Hi   Expr
+}
+
+// GroupExpr is a parenthesised list of expressions, usually just one.
+type GroupExpr struct {
+	Span  Span
+	Elems []Expr
+}
+
+// ListType is the type `[Len]Elem`, or `[]Elem` for a dynamic list with a
+// nil Len.
+type ListType struct {
+	Span Span
+	Len  Expr
+	Elem Expr
+}
+
+// ListLit is a list literal, `Type{Elems...}`.
+type ListLit struct {
+	Span  Span
+	Type  *ListType
+	Elems []Expr
+}
+
+//====== Statements ======//
+
+// ExprStmt is an expression standing on its own, e.g. a call.
+type ExprStmt struct {
+	Span Span
+	X    Expr
+}
+
+// VarDecl is `Name := Value`, or `Name #= Value` for a constant with Const
+// set.
+type VarDecl struct {
+	Span  Span
+	Doc   string
+	Const bool
+	Name  *Ident
+	Value Expr
+}
+
+// AssignStmt is `Target = Value`.
+type AssignStmt struct {
+	Span   Span
+	Target Expr
+	Value  Expr
+}
+
+// IncDecStmt is `X++` or `X--`, with Op AST_Inc or AST_Dec.
+type IncDecStmt struct {
+	Span Span
+	Op   ASTKind
+	X    Expr
+}
+
+// IfStmt is `if Cond Body`, with an optional Else that is either a *Block or,
+// for `else if`, an *IfStmt. ElseSpan covers the `else` keyword and Else.
+type IfStmt struct {
+	Span     Span
+	Cond     Expr
+	Body     *Block
+	ElseSpan Span
+	Else     Stmt
+}
+
+// WhileStmt is `while Cond Body`.
+type WhileStmt struct {
+	Span Span
+	Cond Expr
+	Body *Block
+}
+
+// ForStmt is `for Body`, `for Cond Body` or `for Init; Cond; Post Body`. Any
+// of the clauses may be nil. Clauses says whether the three clause form was
+// used, and ClauseSpan covers its clauses.
+type ForStmt struct {
+	Span       Span
+	Clauses    bool
+	ClauseSpan Span
+	Init       Stmt
+	Cond       Expr
+	Post       Stmt
+	Body       *Block
+}
+
+// ReturnStmt is `return`, or `return Value`.
+type ReturnStmt struct {
+	Span  Span
+	Value Expr
+}
+
+// ExitStmt is `exit`, `exit <- Code` or `exit <! Code`, with Op AST_Exit,
+// AST_ExitCode or AST_ExitNow.
+type ExitStmt struct {
+	Span Span
+	Op   ASTKind
+	Code Expr
+}
+
+// Block is `{ Stmts... }`.
+type Block struct {
+	Span  Span
+	Stmts []Stmt
+}
+
+// FuncDecl is `fn Name(Params...) Result { Body... }`, where Result may be
+// nil.
+type FuncDecl struct {
+	Span   Span
+	Doc    string
+	Name   string
+	Params []*Param
+	Result *Result
+	Body   []Stmt
+}
+
+// Param is a `name type` parameter of a function.
+type Param struct {
+	Name *Ident
+	Type Expr
+}
+
+// Result is the return arrow of a function and the types after it. Arrow is
+// one of AST_ReturnOnly, AST_ReturnNil, AST_ReturnErr and AST_ReturnErrNil,
+// and Second is the optional type after a comma.
+type Result struct {
+	Span   Span
+	Arrow  ASTKind
+	Type   Expr
+	Second Expr
+}
+
+// Program is a whole source file.
+type Program struct {
+	Span  Span
+	Stmts []Stmt
+}
+
+//====== Node methods ======//
+
+func (n *BadNode) NodeSpan() Span      { return n.Span }
+func (n *Ident) NodeSpan() Span        { return n.Span }
+func (n *Literal) NodeSpan() Span      { return n.Span }
+func (n *InterpString) NodeSpan() Span { return n.Span }
+func (n *UnaryExpr) NodeSpan() Span    { return n.Span }
+func (n *BinaryExpr) NodeSpan() Span   { return n.Span }
+func (n *CastExpr) NodeSpan() Span     { return n.Span }
+func (n *CallExpr) NodeSpan() Span     { return n.Span }
+func (n *MemberExpr) NodeSpan() Span   { return n.Span }
+func (n *IndexExpr) NodeSpan() Span    { return n.Span }
+func (n *SliceExpr) NodeSpan() Span    { return n.Span }
+func (n *GroupExpr) NodeSpan() Span    { return n.Span }
+func (n *ListType) NodeSpan() Span     { return n.Span }
+func (n *ListLit) NodeSpan() Span      { return n.Span }
+func (n *ExprStmt) NodeSpan() Span     { return n.Span }
+func (n *VarDecl) NodeSpan() Span      { return n.Span }
+func (n *AssignStmt) NodeSpan() Span   { return n.Span }
+func (n *IncDecStmt) NodeSpan() Span   { return n.Span }
+func (n *IfStmt) NodeSpan() Span       { return n.Span }
+func (n *WhileStmt) NodeSpan() Span    { return n.Span }
+func (n *ForStmt) NodeSpan() Span      { return n.Span }
+func (n *ReturnStmt) NodeSpan() Span   { return n.Span }
+func (n *ExitStmt) NodeSpan() Span     { return n.Span }
+func (n *Block) NodeSpan() Span        { return n.Span }
+func (n *FuncDecl) NodeSpan() Span     { return n.Span }
+func (n *Result) NodeSpan() Span       { return n.Span }
+func (n *Program) NodeSpan() Span      { return n.Span }
+
+func (n *Param) NodeSpan() Span {
+	return Span{File: n.Name.Span.File, Start: n.Name.Span.Start, End: n.Type.NodeSpan().End}
+}
+
+func (*BadNode) exprNode()      {}
+func (*Ident) exprNode()        {}
+func (*Literal) exprNode()      {}
+func (*InterpString) exprNode() {}
+func (*UnaryExpr) exprNode()    {}
+func (*BinaryExpr) exprNode()   {}
+func (*CastExpr) exprNode()     {}
+func (*CallExpr) exprNode()     {}
+func (*MemberExpr) exprNode()   {}
+func (*IndexExpr) exprNode()    {}
+func (*SliceExpr) exprNode()    {}
+func (*GroupExpr) exprNode()    {}
+func (*ListType) exprNode()     {}
+func (*ListLit) exprNode()      {}
+
+func (*BadNode) stmtNode()    {}
+func (*ExprStmt) stmtNode()   {}
+func (*VarDecl) stmtNode()    {}
+func (*AssignStmt) stmtNode() {}
+func (*IncDecStmt) stmtNode() {}
+func (*IfStmt) stmtNode()     {}
+func (*WhileStmt) stmtNode()  {}
+func (*ForStmt) stmtNode()    {}
+func (*ReturnStmt) stmtNode() {}
+func (*ExitStmt) stmtNode()   {}
+func (*Block) stmtNode()      {}
+func (*FuncDecl) stmtNode()   {}
@@ -1,746 +1,1454 @@
 package include
 
 import (
-	"bufio"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"slices"
+	"strconv"
 	"strings"
-	"unicode"
 )
 
-func GenerateAST() (ASTNode, *Error) {
-	srcPath := "main.wp"
-	if len(os.Args) > 1 {
-		srcPath = os.Args[1]
+// errReported stands in for a diagnostic that was already recorded, e.g. by
+// the lexer for a TOK_Bad token, so that recovery doesn't report it twice.
+var errReported = &Diagnostic{Message: "error already reported"}
+
+// ParseFile reads and parses the source file at path. A file that can't be
+// read is reported as a diagnostic like any syntax error.
+func ParseFile(path string, opts *Options) *File {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return &File{Name: path, Diags: []*Diagnostic{{Code: 10, Message: err.Error(), Span: Span{File: path}}}}
 	}
 
-	file, err := os.Open(srcPath)
+	return ParseString(path, string(src), opts)
+}
+
+// ParseReader parses all of the source read from r, naming it name in spans
+// and diagnostics.
+func ParseReader(name string, r io.Reader, opts *Options) *File {
+	src, err := io.ReadAll(r)
 	if err != nil {
-		return ASTNode{}, &Error{err.Error(), 10}
+		return &File{Name: name, Diags: []*Diagnostic{{Code: 10, Message: err.Error(), Span: Span{File: name}}}}
+	}
+
+	return ParseString(name, string(src), opts)
+}
+
+// ParseString parses src, naming it name in spans and diagnostics. Syntax
+// errors don't stop it: each broken statement becomes an AST_Bad node and
+// every diagnostic is returned next to the partial tree. A nil opts uses the
+// defaults.
+func ParseString(name, src string, opts *Options) *File {
+	if opts == nil {
+		opts = &Options{}
 	}
-	defer file.Close()
 
-	rootNode := ASTNode{
+	tokens, comments, lexDiags := Lex(name, src)
+
+	rootNode := &ASTNode{
 		Kind: AST_Root,
 	}
 
 	tree := []*ASTNode{}
 
-	lineNum := 1
 	p := &Parser{
-		Scanner: *bufio.NewScanner(file),
+		File:     name,
+		Context:  AST_Root,
+		Trace:    opts.Trace,
+		Tokens:   tokens,
+		Comments: comments,
+		Diags:    lexDiags,
 	}
 
-	for p.Scanner.Scan() {
-		line := strings.TrimSpace(p.Scanner.Text())
-
-		if len(line) == 0 || len(line) >= 2 && line[0:2] == "//" {
-			lineNum++
-			continue
+	for p.skipStmtEnds(); p.peek().Kind != TOK_EOF; p.skipStmtEnds() {
+		if opts.MaxErrors > 0 && len(p.Diags) >= opts.MaxErrors {
+			break
 		}
 
-		nodes, err, _ := p.parse(-1, nil)
+		startCursor := p.Cursor
+		stmt, err := p.parseStmt()
 		if err != nil {
-			return ASTNode{}, err
+			stmt = p.recoverFrom(err, startCursor)
 		}
 
-		tree = append(tree, nodes...)
-		lineNum++
+		tree = append(tree, stmt)
 	}
 
 	rootNode.Children = tree
+	rootNode.Span = Span{
+		File:  name,
+		Start: Position{Line: 1, Col: 1},
+		End:   p.peek().End,
+	}
 
-	return rootNode, nil
-}
+	slices.SortStableFunc(p.Diags, func(a, b *Diagnostic) int {
+		return a.Span.Start.Offset - b.Span.Start.Offset
+	})
 
-func (p *Parser) parse(exprs int, toParse *string) ([]*ASTNode, *Error, int) {
-	var line string
+	if opts.MaxErrors > 0 && len(p.Diags) > opts.MaxErrors {
+		p.Diags = p.Diags[:opts.MaxErrors]
+	}
 
-	if toParse != nil {
-		line = *toParse
-	} else {
-		line = strings.TrimSpace(p.Scanner.Text())
+	return &File{
+		Name:     name,
+		Src:      src,
+		Root:     rootNode,
+		Comments: p.Comments,
+		Diags:    p.Diags,
 	}
+}
 
-	nodes := []*ASTNode{}
-	var char int
+// docFor returns the text of the `///` comments on the lines right above pos,
+// without their markers, as the documentation of the declaration there.
+func (p *Parser) docFor(pos Position) string {
+	lines := []string{}
+	line := pos.Line - 1
 
-	for char = 0; char < len(line); char++ {
-		if exprs == 0 {
+	for i := len(p.Comments) - 1; i >= 0; i-- {
+		comment := p.Comments[i]
+		if comment.Span.Start.Offset >= pos.Offset {
+			continue
+		}
+
+		if comment.Kind != COM_Doc || comment.Span.Start.Line != line {
 			break
 		}
 
-		node := &ASTNode{}
+		text := strings.TrimPrefix(comment.Text, "///")
+		lines = append(lines, strings.TrimPrefix(text, " "))
+		line--
+	}
 
-		// Skip all whitespace
-		if unicode.IsSpace(rune(line[char])) {
-			exprs++
+	slices.Reverse(lines)
+	return strings.Join(lines, "\n")
+}
 
-			for unicode.IsSpace(rune(line[char])) && char < len(line) {
-				char++
-			}
-		}
+// binaryOps maps each binary operator to its node kind and precedence. A
+// higher precedence binds tighter:
+//
+//	1   |
+//	2   &
+//	3   ==  !=  >  <  >=  <=
+//	4   .|
+//	5   .^
+//	6   .&
+//	7   .<  .>
+//	8   +  -
+//	9   *  /  %
+//	10  ^
+//	11  ::
+//
+// All of them are left associative except `^`, so `a - b - c` is
+// `(a - b) - c` but `a ^ b ^ c` is `a ^ (b ^ c)`. The prefix operators `!`,
+// `.!` and `::` bind tighter than any binary operator. So does a prefix `-`,
+// but for `^`: as in maths, `-2 ^ 2` is `-(2 ^ 2)`.
+var binaryOps = map[TokenKind]struct {
+	Kind ASTKind
+	Prec int
+}{
+	TOK_Or:             {AST_Or, 1},
+	TOK_And:            {AST_And, 2},
+	TOK_Equal:          {AST_Equal, 3},
+	TOK_NotEqual:       {AST_NotEqual, 3},
+	TOK_Greater:        {AST_Greater, 3},
+	TOK_Lesser:         {AST_Lesser, 3},
+	TOK_GreaterOrEqual: {AST_GreaterOrEqual, 3},
+	TOK_LesserOrEqual:  {AST_LesserOrEqual, 3},
+	TOK_BOr:            {AST_BOr, 4},
+	TOK_BXor:           {AST_BXor, 5},
+	TOK_BAnd:           {AST_BAnd, 6},
+	TOK_BLeft:          {AST_BLeft, 7},
+	TOK_BRight:         {AST_BRight, 7},
+	TOK_Add:            {AST_Add, 8},
+	TOK_Sub:            {AST_Sub, 8},
+	TOK_Mul:            {AST_Mul, 9},
+	TOK_Div:            {AST_Div, 9},
+	TOK_Mod:            {AST_Mod, 9},
+	TOK_Pow:            {AST_Pow, 10},
+	TOK_TypeOp:         {AST_TypeCast, 11},
+}
 
-		// Parse identifiers
-		if unicode.IsLetter(rune(line[char])) {
-			node.Kind = AST_Id
+var prefixOps = map[TokenKind]ASTKind{
+	TOK_Not:    AST_Not,
+	TOK_BNot:   AST_BNot,
+	TOK_Sub:    AST_Neg,
+	TOK_TypeOp: AST_TypeOf,
+}
 
-			for char < len(line) && unicode.IsLetter(rune(line[char])) {
-				node.Value += string(line[char])
-				char++
-			}
+// parseStmt parses a single statement, which has to end the line, be ended
+// explicitly with `;` or, inside a block, be followed by the closing `}`.
+func (p *Parser) parseStmt() (*ASTNode, *Diagnostic) {
+	tok := p.peek()
+
+	var node *ASTNode
+	var err *Diagnostic
+
+	switch {
+	case tok.Kind == TOK_Keyword && tok.Value == "fn":
+		p.next()
+		node, err = p.parseFn(tok.Pos)
+	case tok.Kind == TOK_Keyword && tok.Value == "if":
+		p.next()
+		node, err = p.parseIf(tok)
+	case tok.Kind == TOK_Keyword && tok.Value == "while":
+		p.next()
+		node, err = p.parseWhile(tok)
+	case tok.Kind == TOK_Keyword && tok.Value == "for":
+		p.next()
+		node, err = p.parseFor(tok)
+	case tok.Kind == TOK_Keyword && tok.Value == "return":
+		p.next()
+		node, err = p.parseReturn(tok)
+	case tok.Kind == TOK_Keyword && tok.Value == "exit":
+		p.next()
+		node, err = p.parseExit(tok)
+	case tok.Kind == TOK_LBrace:
+		node, err = p.parseBlock()
+	default:
+		node, err = p.parseSimpleStmt()
+	}
 
-			switch node.Value {
-			case "fn":
-				if p.Context == AST_Function {
-					err := "Expected function name after `fn` keyword"
-					return nil, &Error{err, 63}, char
-				}
+	if err != nil {
+		return nil, err
+	}
 
-				fnNode, newChar, err := p.parseFn(line, char)
-				if err != nil {
-					return nil, err, char
-				}
+	if end := p.peek(); end.Kind == TOK_Colon {
+		err := "Expected another `:`"
+		return nil, &Diagnostic{
+			Code:    27,
+			Message: err,
+			Span:    p.tokenSpan(end),
+			Fixes: []Fix{
+				{Span: p.tokenSpan(end), Replacement: "::", Message: "for a type cast or `typeOf`"},
+				{Span: p.tokenSpan(end), Replacement: ":=", Message: "for a variable declaration"},
+			},
+		}
+	} else if end.Kind == TOK_Semi {
+		p.next()
+	} else if end.Kind == TOK_Bad {
+		// The lexer has reported it already
+		p.next()
+		return nil, errReported
+	} else if !p.atStmtEnd() {
+		err := fmt.Sprintf("Expected end of statement, found %s", end.Kind)
+		return nil, &Diagnostic{Code: 29, Message: err, Span: p.tokenSpan(end)}
+	}
 
-				node = fnNode
-				char = newChar
-			case "return":
-			// TODO: `parseReturn` method
-			case "exit":
-			// TODO: `parseExit` method
-			case "true":
-				node.Kind = AST_True
-				node.Value = ""
-			case "false":
-				node.Kind = AST_False
-				node.Value = ""
-			case "nil":
-				node.Kind = AST_Nil
-				node.Value = ""
-			}
+	if p.Trace != nil {
+		fmt.Fprintf(p.Trace, "Value: %s, Kind: %s\n", node.Value, node.Kind)
+	}
 
-			char--
-			// Parse numbers
-		} else if unicode.IsNumber(rune(line[char])) {
-			node.Kind = AST_Int
-
-			for char < len(line) && !unicode.IsSpace(rune(line[char])) {
-				node.Value += string(line[char])
-
-				if unicode.IsLetter(rune(line[char])) {
-					switch node.Kind {
-					case AST_Int:
-						node.Kind = AST_Id
-
-						if char > 0 && line[char-1] == '0' {
-							switch line[char] {
-							case 'x':
-								node.Kind = AST_Hex
-							case 'b':
-								node.Kind = AST_Binary
-							}
-						}
-					case AST_Binary:
-						err := fmt.Sprintf("Invalid char found in binary, expected `0` or `1`: `%s`", string(line[char]))
-						return nil, &Error{err, 20}, char
-					case AST_Hex:
-						if !strings.Contains("ABCDEFabcdef", string(line[char])) {
-							err := fmt.Sprintf("Invalid char found in hexadecimal, expected `0-9`, `a-f` or `A-F`: `%s`", string(line[char]))
-							return nil, &Error{err, 20}, char
-						}
-					case AST_Float:
-						err := fmt.Sprintf("Invalid char in float, expected `0-9`: `%s`", string(line[char]))
-						return nil, &Error{err, 21}, char
-					}
-				} else if line[char] == '.' {
-					if char+1 < len(line) && unicode.IsSymbol(rune(line[char+1])) {
-						node.Value = node.Value[:len(node.Value)-1]
-						char--
-						break
-					} else if node.Kind == AST_Float {
-						err := fmt.Sprintf("Invalid char in float, expected `0-9`: `%s`", string(line[char]))
-						return nil, &Error{err, 21}, char
-					} else {
-						node.Kind = AST_Float
-					}
-				} else if unicode.IsSymbol(rune(line[char])) || strings.Contains("+-*/^%", string(line[char])) {
-					node.Value = node.Value[:len(node.Value)-1]
-					char--
-					break
-				}
+	if node.Kind == AST_Function || node.Kind == AST_Variable || node.Kind == AST_Constant {
+		node.Doc = p.docFor(node.Span.Start)
+	}
 
-				if !unicode.IsSymbol(rune(line[char])) {
-					char++
-				}
-			}
-			// Parse strings
-		} else if strings.Contains("'\"`", string(line[char])) {
-			node = &ASTNode{
-				Kind: AST_String,
-			}
+	return node, nil
+}
 
-			// Move over the first quote
-			char++
+// parseIf parses `if cond { ... }` with the condition in LHS and the block in
+// RHS. An `else` hangs off Alt, holding either the block or, for `else if`,
+// the next AST_If.
+func (p *Parser) parseIf(keyword Token) (*ASTNode, *Diagnostic) {
+	node := &ASTNode{}
+	node.Kind = AST_If
 
-			for char < len(line) && !strings.Contains("'\"`", string(line[char])) {
-				node.Value += string(line[char])
-				char++
-			}
+	cond, err := p.parseCond(keyword)
+	if err != nil {
+		return nil, err
+	}
 
-			if !strings.Contains("'\"`", string(line[char])) {
-				err := "Missing string terminator"
-				return nil, &Error{err, 23}, char
-			}
-		} else if strings.Contains("+-*/%^.", string(line[char])) {
-			opNode, newChar, newNodes, err := p.parseOp(line, char, nodes)
-			if err != nil {
-				return nil, err, char
-			}
+	node.LHS = cond
 
-			node = opNode
-			char = newChar
-			nodes = newNodes
-		} else if strings.Contains("=<>", string(line[char])) {
-			eqNode, newChar, newNodes, err := p.parseEq(line, char, nodes)
-			if err != nil {
-				return nil, err, char
-			}
+	block, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
 
-			node = eqNode
-			char = newChar
-			nodes = newNodes
-		} else if line[char] == '!' {
-			notNode, newChar, newNodes, err := p.parseNot(line, char, nodes)
-			if err != nil {
-				return nil, err, char
-			}
+	node.RHS = block
 
-			node = notNode
-			char = newChar
-			nodes = newNodes
-		} else if line[char] == ':' {
-			opNode, newChar, newNodes, err := p.parseTypeOp(line, char, nodes)
-			if err != nil {
-				return nil, err, char
-			}
+	// `else` may start the line after the closing `}`
+	cursor := p.Cursor
+	p.skipNewlines()
 
-			node = opNode
-			char = newChar
-			nodes = newNodes
-		} else if line[char] == '{' {
-			blockNode, newChar, err := p.parseBlock(line, char)
-			if err != nil {
-				return nil, err, char
-			}
+	elseTok := p.peek()
+	if elseTok.Kind != TOK_Keyword || elseTok.Value != "else" {
+		p.Cursor = cursor
+		node.Span = p.spanFrom(keyword.Pos)
 
-			node = blockNode
-			char = newChar
-		} else if p.Context == AST_Block && line[char] == '}' {
-			return nil, nil, char
-		} else if line[char] == '(' {
-			groupNode, newChar, err := p.parseGroup(line, char)
-			if err != nil {
-				return nil, err, char
-			}
+		return node, nil
+	}
 
-			node = groupNode
-			char = newChar
-		} else if (p.Context == AST_Function || p.Context == AST_Group) && line[char] == ')' {
-			return nil, nil, char
-		} else {
-			err := fmt.Sprintf("Invalid symbol: `%s`", string(line[char]))
-			return nil, &Error{err, 22}, char
-		}
+	p.next()
 
-		exprs--
-		nodes = append(nodes, node)
+	alt := &ASTNode{}
+	alt.Kind = AST_Else
+
+	if next := p.peek(); next.Kind == TOK_Keyword && next.Value == "if" {
+		p.next()
+		alt.LHS, err = p.parseIf(next)
+	} else {
+		alt.LHS, err = p.parseBlock()
 	}
 
-	for _, node := range nodes {
-		fmt.Printf("Value: %s, Kind: %s\n", node.Value, node.Kind)
+	if err != nil {
+		return nil, err
 	}
 
-	return nodes, nil, char
+	alt.Span = p.spanFrom(elseTok.Pos)
+	node.Alt = alt
+	node.Span = p.spanFrom(keyword.Pos)
+
+	return node, nil
 }
 
-func (p *Parser) parseOp(line string, char int, nodes []*ASTNode) (*ASTNode, int, []*ASTNode, *Error) {
+// parseWhile parses `while cond { ... }` with the condition in LHS and the
+// block in RHS.
+func (p *Parser) parseWhile(keyword Token) (*ASTNode, *Diagnostic) {
 	node := &ASTNode{}
+	node.Kind = AST_While
+
+	cond, err := p.parseCond(keyword)
+	if err != nil {
+		return nil, err
+	}
+
+	node.LHS = cond
 
-	if len(nodes) == 0 || nodes == nil ||
-		!slices.Contains(append(append(AST_Num, AST_String, AST_Id), append(AST_Math, AST_Bitwise...)...), nodes[max(0, len(nodes)-1)].Kind) {
-		err := "Expected number or string as LHS of operator"
-		return nil, char, nodes, &Error{err, 24}
+	block, err := p.parseBlock()
+	if err != nil {
+		return nil, err
 	}
 
-	node.LHS = nodes[max(0, len(nodes)-1)]
+	node.RHS = block
+	node.Span = p.spanFrom(keyword.Pos)
 
-	switch line[char] {
-	//====== Math ======//
-	case '+':
-		node.Kind = AST_Add
-		char++
+	return node, nil
+}
 
-		if char < len(line) && line[char] == '+' {
-			node.Kind = AST_Inc
-			if nodes[max(0, len(nodes)-1)].Kind == AST_String {
-				err := "Expected number as LHS of increment"
-				return nil, char, nodes, &Error{err, 24}
-			}
+// parseFor parses the three forms of `for`, with the block in RHS:
+//
+//	for { ... }                    LHS is nil
+//	for cond { ... }               LHS is the condition
+//	for init; cond; post { ... }   LHS is an AST_Group of the three clauses
+//
+// Any of the three clauses may be left empty.
+func (p *Parser) parseFor(keyword Token) (*ASTNode, *Diagnostic) {
+	node := &ASTNode{}
+	node.Kind = AST_For
 
-			char++
+	if p.peek().Kind != TOK_LBrace {
+		start := p.peek().Pos
+
+		first, err := p.parseClause()
+		if err != nil {
+			return nil, err
 		}
-	case '-':
-		node.Kind = AST_Sub
-		char++
 
-		if char < len(line) && line[char] == '-' {
-			node.Kind = AST_Dec
+		if p.peek().Kind != TOK_Semi {
+			node.LHS = first[0]
+		} else {
+			clauses := [][]*ASTNode{first}
+
+			for len(clauses) < 3 {
+				if tok := p.peek(); tok.Kind != TOK_Semi {
+					err := fmt.Sprintf("Expected `;` between `for` clauses, found %s", tok.Kind)
+					return nil, &Diagnostic{
+						Code:    33,
+						Message: err,
+						Span:    p.tokenSpan(tok),
+						Notes:   []string{"loops are written as `for init; cond; post { ... }`, e.g. `for i := 0; i < 10; i++ { ... }`"},
+					}
+				}
+				p.next()
 
-			if nodes[max(0, len(nodes)-1)].Kind == AST_String {
-				err := "Expected number as LHS of decrement"
-				return nil, char, nodes, &Error{err, 24}
+				clause, err := p.parseClause()
+				if err != nil {
+					return nil, err
+				}
+
+				clauses = append(clauses, clause)
 			}
 
-			char++
-		}
-	case '*':
-		node.Kind = AST_Mul
-		char++
-	case '/':
-		node.Kind = AST_Div
-		char++
-	case '%':
-		node.Kind = AST_Mod
-		char++
-	case '^':
-		node.Kind = AST_Pow
-		char++
-
-	//====== Bitwise ======//
-	case '.':
-		char++
-
-		if char >= len(line) {
-			err := "Expected operator after bitwise initializer"
-			return nil, char, nodes, &Error{err, 25}
-		}
-
-		switch line[char] {
-		case '&':
-			node.Kind = AST_BAnd
-		case '|':
-			node.Kind = AST_BOr
-		case '^':
-			node.Kind = AST_BXor
-		case '<':
-			node.Kind = AST_BLeft
-		case '>':
-			node.Kind = AST_BRight
-		default:
-			err := fmt.Sprintf("Invalid operator: `%s`", string(line[char-1:char+1]))
-			return nil, char, nodes, &Error{err, 25}
+			group := &ASTNode{}
+			group.Kind = AST_Group
+			group.Params = clauses
+			group.Span = p.spanFrom(start)
+
+			node.LHS = group
 		}
+	}
+
+	block, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	node.RHS = block
+	node.Span = p.spanFrom(keyword.Pos)
+
+	return node, nil
+}
+
+// parseClause parses one, possibly empty, clause of a `for`.
+func (p *Parser) parseClause() ([]*ASTNode, *Diagnostic) {
+	if kind := p.peek().Kind; kind == TOK_Semi || kind == TOK_LBrace {
+		return []*ASTNode{}, nil
+	}
 
-		char++
+	stmt, err := p.parseSimpleStmt()
+	if err != nil {
+		return nil, err
 	}
 
-	if char >= len(line) && !slices.Contains([]ASTKind{AST_Inc, AST_Dec}, node.Kind) {
-		err := "Expected expression after operator"
-		return nil, char, nodes, &Error{err, 26}
+	return []*ASTNode{stmt}, nil
+}
+
+// parseCond parses the condition of an `if` or `while`.
+func (p *Parser) parseCond(keyword Token) (*ASTNode, *Diagnostic) {
+	if tok := p.peek(); tok.Kind == TOK_LBrace || p.atLineEnd() {
+		err := fmt.Sprintf("Expected condition after `%s`", keyword.Value)
+		return nil, &Diagnostic{Code: 26, Message: err, Span: p.tokenSpan(tok)}
 	}
 
-	if !slices.Contains([]ASTKind{AST_Inc, AST_Dec}, node.Kind) {
-		for unicode.IsSpace(rune(line[char])) && char < len(line) {
-			char++
+	return p.parseExpr(0)
+}
+
+// parseReturn parses `return` with an optional value, only allowed inside of
+// a function.
+func (p *Parser) parseReturn(keyword Token) (*ASTNode, *Diagnostic) {
+	node := &ASTNode{}
+	node.Kind = AST_Return
+
+	if p.Fn == nil {
+		err := "Unexpected `return` outside of a function"
+		return nil, &Diagnostic{
+			Code:    30,
+			Message: err,
+			Span:    p.tokenSpan(keyword),
+			Notes:   []string{"use `exit` to end the program from the top level"},
 		}
+	}
 
-		rhsStart := line[char:]
-		rhs, err, charInc := p.parse(1, &rhsStart)
+	if !p.atStmtEnd() {
+		value, err := p.parseExpr(0)
 		if err != nil {
-			return nil, char, nodes, err
+			return nil, err
 		}
-		char += charInc
-
-		nodes = append(nodes, rhs[0])
 
-		if len(nodes) == 0 || nodes == nil || !slices.Contains(append(AST_Num, AST_String, AST_Id), nodes[max(0, len(nodes)-1)].Kind) {
-			err := "Expected number or string as RHS of operator"
-			return nil, char, nodes, &Error{err, 26}
+		if p.Fn.RHS == nil {
+			err := fmt.Sprintf("Unexpected return value in function `%s` without a return type", p.Fn.Value)
+			return nil, &Diagnostic{
+				Code:    32,
+				Message: err,
+				Span:    value.Span,
+				Notes:   []string{"declare what the function returns with `->`, `~>`, `!>` or `?>`, e.g. `fn f() -> int`"},
+			}
 		}
 
-		node.RHS = nodes[max(0, len(nodes)-1)]
-		nodes = nodes[:max(0, len(nodes)-1)]
+		node.LHS = value
+	}
+
+	node.Span = p.spanFrom(keyword.Pos)
+
+	return node, nil
+}
+
+// parseExit parses a bare `exit`, `exit <- code` and `exit <! code`.
+func (p *Parser) parseExit(keyword Token) (*ASTNode, *Diagnostic) {
+	node := &ASTNode{}
+	node.Kind = AST_Exit
+
+	op := p.peek()
+
+	switch op.Kind {
+	case TOK_ExitCode:
+		node.Kind = AST_ExitCode
+	case TOK_ExitNow:
+		node.Kind = AST_ExitNow
+	default:
+		node.Span = p.spanFrom(keyword.Pos)
+		return node, nil
+	}
+
+	p.next()
+
+	if p.atStmtEnd() {
+		err := fmt.Sprintf("Expected exit code after %s", op.Kind)
+		return nil, &Diagnostic{Code: 26, Message: err, Span: p.tokenSpan(op)}
+	}
+
+	code, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if slices.Contains([]ASTKind{AST_Float, AST_String, AST_Char, AST_True, AST_False, AST_Nil}, code.Kind) {
+		err := fmt.Sprintf("Expected integer exit code, found %s", code.Kind)
+		return nil, &Diagnostic{Code: 31, Message: err, Span: code.Span}
 	}
 
-	nodes = nodes[:max(0, len(nodes)-1)]
+	node.LHS = code
+	node.Span = p.spanFrom(keyword.Pos)
 
-	return node, char - 1, nodes, nil
+	return node, nil
 }
 
-func (p *Parser) parseEq(line string, char int, nodes []*ASTNode) (*ASTNode, int, []*ASTNode, *Error) {
+// parseSimpleStmt parses an expression, optionally assigned to with `=`,
+// declared with `:=` or `#=`, or incremented or decremented.
+func (p *Parser) parseSimpleStmt() (*ASTNode, *Diagnostic) {
+	lhs, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+
 	node := &ASTNode{}
+	node.LHS = lhs
+
+	tok := p.peek()
+
+	switch tok.Kind {
+	case TOK_Assign, TOK_Variable, TOK_Constant:
+		node.Kind = map[TokenKind]ASTKind{
+			TOK_Assign:   AST_Assign,
+			TOK_Variable: AST_Variable,
+			TOK_Constant: AST_Constant,
+		}[tok.Kind]
+
+		if lhs.Kind != AST_Id && (tok.Kind != TOK_Assign || !slices.Contains([]ASTKind{AST_Member, AST_Index}, lhs.Kind)) {
+			err := fmt.Sprintf("Expected identifier as LHS of %s", tok.Kind)
+			return nil, &Diagnostic{Code: 24, Message: err, Span: lhs.Span}
+		}
+
+		p.next()
+
+		if p.atLineEnd() {
+			err := "Expected expression after assignment"
+			return nil, &Diagnostic{Code: 26, Message: err, Span: p.tokenSpan(tok)}
+		}
+
+		rhs, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+
+		node.RHS = rhs
+	case TOK_Inc, TOK_Dec:
+		node.Kind = AST_Inc
+		if tok.Kind == TOK_Dec {
+			node.Kind = AST_Dec
+		}
+
+		if !slices.Contains([]ASTKind{AST_Id, AST_Member, AST_Index}, lhs.Kind) {
+			err := fmt.Sprintf("Expected identifier as LHS of %s", tok.Kind)
+			return nil, &Diagnostic{Code: 24, Message: err, Span: lhs.Span}
+		}
 
-	if len(nodes) == 0 || nodes == nil ||
-		!slices.Contains(append(append(AST_Num, AST_String, AST_Id, AST_TypeOf, AST_TypeCast), AST_Bool...),
-			nodes[max(0, len(nodes)-1)].Kind) {
-		err := "Expected typeOf, type cast, bool, ientifier, number, string, identifier or boolean as LHS of equality"
-		return nil, char, nodes, &Error{err, 24}
+		p.next()
+	default:
+		return lhs, nil
 	}
 
-	node.LHS = nodes[max(0, len(nodes)-1)]
-	nodes = nodes[:max(0, len(nodes)-1)]
+	node.Span = p.spanFrom(lhs.Span.Start)
+
+	return node, nil
+}
 
-	switch line[char] {
-	case '=':
-		node.Kind = AST_Assign
-		char++
-	case '>':
-		node.Kind = AST_Greater
-		char++
-	case '<':
-		node.Kind = AST_Lesser
-		char++
+// parseExpr parses a binary expression whose operators all have a precedence
+// of at least minPrec, see binaryOps.
+func (p *Parser) parseExpr(minPrec int) (*ASTNode, *Diagnostic) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
 	}
 
-	if char < len(line) && line[char] == '=' {
-		switch line[char-1] {
-		case '=':
-			node.Kind = AST_Equal
-		case '>':
-			node.Kind = AST_GreaterOrEqual
-		case '<':
-			node.Kind = AST_LesserOrEqual
+	return p.parseBinary(lhs, minPrec)
+}
+
+// parseBinary parses the binary operators after lhs, and their right-hand
+// sides, whose precedence is at least minPrec.
+func (p *Parser) parseBinary(lhs *ASTNode, minPrec int) (*ASTNode, *Diagnostic) {
+	var err *Diagnostic
+
+	for {
+		op, ok := binaryOps[p.peek().Kind]
+		if !ok || op.Prec < minPrec {
+			return lhs, nil
 		}
 
-		char++
+		opTok := p.next()
+
+		node := &ASTNode{}
+		node.Kind = op.Kind
+		node.LHS = lhs
+
+		if p.atLineEnd() {
+			err := "Expected expression after operator"
+			return nil, &Diagnostic{Code: 26, Message: err, Span: p.tokenSpan(opTok)}
+		}
+
+		if op.Kind == AST_TypeCast {
+			node.RHS, err = p.parseType()
+		} else if op.Kind == AST_Pow {
+			node.RHS, err = p.parseExpr(op.Prec)
+		} else {
+			node.RHS, err = p.parseExpr(op.Prec + 1)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		node.Span = p.spanFrom(lhs.Span.Start)
+		lhs = node
+	}
+}
+
+func (p *Parser) parseUnary() (*ASTNode, *Diagnostic) {
+	tok := p.peek()
+
+	kind, ok := prefixOps[tok.Kind]
+	if !ok {
+		return p.parsePostfix()
 	}
 
-	if char >= len(line) {
-		err := "Expected expression after equality"
-		return nil, char, nodes, &Error{err, 26}
+	p.next()
+
+	if p.atLineEnd() {
+		err := fmt.Sprintf("Expected expression after %s", tok.Kind)
+		return nil, &Diagnostic{Code: 26, Message: err, Span: p.tokenSpan(tok)}
 	}
 
-	for unicode.IsSpace(rune(line[char])) && char < len(line) {
-		char++
+	operand, err := p.parseUnary()
+	if err == nil && kind == AST_Neg && p.peek().Kind == TOK_Pow {
+		operand, err = p.parseBinary(operand, binaryOps[TOK_Pow].Prec)
 	}
 
-	rhsStart := line[char:]
-	rhs, err, charInc := p.parse(1, &rhsStart)
 	if err != nil {
-		return nil, char, nodes, err
+		return nil, err
 	}
-	char += charInc
 
-	nodes = append(nodes, rhs[0])
+	node := &ASTNode{}
+	node.Kind = kind
+	node.LHS = operand
+	node.Span = p.spanFrom(tok.Pos)
+
+	return node, nil
+}
 
-	if len(nodes) == 0 || nodes == nil ||
-		!slices.Contains(append(append(AST_Num, AST_String, AST_Id, AST_TypeOf, AST_TypeCast), AST_Bool...),
-			nodes[max(0, len(nodes)-1)].Kind) {
-		err := "Expected typeOf, type cast, bool, identifier, number or string as RHS of equality"
-		return nil, char, nodes, &Error{err, 26}
+// parsePostfix parses an operand followed by any number of calls, member
+// accesses, indexes and slices, e.g. `list.filter(even)[1:].len()`.
+func (p *Parser) parsePostfix() (*ASTNode, *Diagnostic) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
 	}
 
-	node.RHS = nodes[max(0, len(nodes)-1)]
-	nodes = nodes[:max(0, len(nodes)-1)]
+	for {
+		switch p.peek().Kind {
+		case TOK_LParen:
+			args, err := p.parseGroup()
+			if err != nil {
+				return nil, err
+			}
+
+			call := &ASTNode{}
+			call.Kind = AST_Call
+			call.LHS = node
+			call.Params = args.Params
+			call.Span = p.spanFrom(node.Span.Start)
 
-	return node, char, nodes, nil
+			node = call
+		case TOK_Dot:
+			p.next()
+
+			name := p.peek()
+			if name.Kind != TOK_Id {
+				err := fmt.Sprintf("Expected member name after `.`, found %s", name.Kind)
+				return nil, &Diagnostic{Code: 26, Message: err, Span: p.tokenSpan(name)}
+			}
+			p.next()
+
+			member := &ASTNode{}
+			member.Kind = AST_Member
+			member.LHS = node
+			member.Value = name.Value
+			member.Span = p.spanFrom(node.Span.Start)
+
+			node = member
+		case TOK_LBrack:
+			index, err := p.parseIndex(node)
+			if err != nil {
+				return nil, err
+			}
+
+			node = index
+		default:
+			return node, nil
+		}
+	}
 }
 
-func (p *Parser) parseNot(line string, char int, nodes []*ASTNode) (*ASTNode, int, []*ASTNode, *Error) {
+func (p *Parser) parsePrimary() (*ASTNode, *Diagnostic) {
+	tok := p.peek()
 	node := &ASTNode{}
 
-	node.Kind = AST_Not
-	char++
+	switch tok.Kind {
+	case TOK_Bad:
+		p.next()
+		return nil, errReported
+	// Parse identifiers
+	case TOK_Id:
+		p.next()
+
+		node.Kind = AST_Id
+		node.Value = tok.Value
+	case TOK_Keyword:
+		switch tok.Value {
+		case "true":
+			node.Kind = AST_True
+		case "false":
+			node.Kind = AST_False
+		case "nil":
+			node.Kind = AST_Nil
+		default:
+			err := fmt.Sprintf("Expected expression, found keyword `%s`", tok.Value)
+			return nil, &Diagnostic{Code: 26, Message: err, Span: p.tokenSpan(tok)}
+		}
+
+		p.next()
+	// Parse numbers
+	case TOK_Int, TOK_Float, TOK_Hex, TOK_Octal, TOK_Binary:
+		p.next()
+
+		node.Kind = map[TokenKind]ASTKind{
+			TOK_Int:    AST_Int,
+			TOK_Float:  AST_Float,
+			TOK_Hex:    AST_Hex,
+			TOK_Octal:  AST_Octal,
+			TOK_Binary: AST_Binary,
+		}[tok.Kind]
+		node.Value = tok.Value
+		node.Raw = tok.Raw
+		node.Suffix = tok.Suffix
+
+		if err := p.decodeNumber(node, tok, p.negated(p.Cursor-1)); err != nil {
+			return nil, err
+		}
+	// Parse strings
+	case TOK_String, TOK_Char:
+		if len(tok.Parts) > 0 {
+			return p.parseInterp()
+		}
+
+		p.next()
 
-	if char < len(line) && line[char] == '=' {
-		node.Kind = AST_NotEqual
+		node.Kind = AST_String
+		if tok.Kind == TOK_Char {
+			node.Kind = AST_Char
+		}
 
-		char++
+		node.Value = tok.Value
+		node.Raw = tok.Raw
+	case TOK_LParen:
+		return p.parseGroup()
+	case TOK_LBrack:
+		return p.parseListLit()
+	default:
+		err := fmt.Sprintf("Expected expression, found %s", tok.Kind)
+		return nil, &Diagnostic{Code: 26, Message: err, Span: p.tokenSpan(tok)}
 	}
 
-	if node.Kind == AST_NotEqual {
-		if !slices.Contains(append(append(AST_Num, AST_String, AST_Id), AST_Bool...), nodes[max(0, len(nodes)-1)].Kind) {
-			err := "Expected bool, identifier, number or string as LHS of equality"
-			return nil, char, nodes, &Error{err, 24}
+	node.Span = p.spanFrom(tok.Pos)
+
+	return node, nil
+}
+
+// decodeNumber sets the Int or Float of a numeric literal node, checking that
+// it fits in the type its suffix names. Without one an integer only has to
+// fit in 64 bits and a float in `f64`, as the checker fits them to the type
+// of where they are used. A negated literal may be the magnitude of the
+// smallest value of its type, as in `-128i8`.
+func (p *Parser) decodeNumber(node *ASTNode, tok Token, negated bool) *Diagnostic {
+	target := node.Suffix
+	if target == "" {
+		target = "u64"
+		if node.Kind == AST_Float {
+			target = "f64"
 		}
+	}
+
+	bits, _ := strconv.Atoi(strings.TrimLeft(target, "iuf"))
 
-		node.LHS = nodes[max(0, len(nodes)-1)]
-		nodes = nodes[:max(0, len(nodes)-1)]
+	if node.Kind == AST_Float {
+		value, err := strconv.ParseFloat(node.Value, bits)
+		if err != nil {
+			err := fmt.Sprintf("Float literal `%s` overflows `%s`", tok.Raw, target)
+			return &Diagnostic{Code: 36, Message: err, Span: p.tokenSpan(tok)}
+		}
+
+		node.Float = value
+		return nil
 	}
 
-	if char >= len(line) {
-		err := "Expected expression"
-		return nil, char, nodes, &Error{err, 26}
+	base := map[ASTKind]int{AST_Int: 10, AST_Hex: 16, AST_Octal: 8, AST_Binary: 2}[node.Kind]
+	digits := node.Value
+	if base != 10 {
+		digits = digits[2:]
 	}
 
-	for unicode.IsSpace(rune(line[char])) && char < len(line) {
-		char++
+	largest := uint64(math.MaxUint64) >> (64 - bits)
+
+	// Signed types lose a bit to the sign
+	if target[0] != 'u' {
+		largest >>= 1
+		if negated {
+			largest++
+		}
 	}
 
-	rhsStart := line[char:]
-	rhs, err, charInc := p.parse(1, &rhsStart)
-	if err != nil {
-		return nil, char, nodes, err
+	value, err := strconv.ParseUint(digits, base, 64)
+	if err != nil || value > largest {
+		note := fmt.Sprintf("the largest `%s` is %d", target, largest)
+		if negated && target[0] != 'u' {
+			note = fmt.Sprintf("the smallest `%s` is -%d", target, largest)
+		}
+
+		err := fmt.Sprintf("Integer literal `%s` overflows `%s`", tok.Raw, target)
+		return &Diagnostic{
+			Code:    36,
+			Message: err,
+			Span:    p.tokenSpan(tok),
+			Notes:   []string{note},
+		}
 	}
-	char += charInc
 
-	nodes = append(nodes, rhs[0])
+	node.Int = value
+	return nil
+}
+
+// negated reports whether the token at i follows a prefix `-`, one that
+// doesn't come after a value, and so is the operand of that `-`.
+func (p *Parser) negated(i int) bool {
+	if i < 1 || p.Tokens[i-1].Kind != TOK_Sub {
+		return false
+	}
 
-	if nodes == nil {
-		err := "Expected expression"
-		return nil, char, nodes, &Error{err, 26}
-	} else if !slices.Contains(append(append(AST_Num, AST_String, AST_Id), AST_Bool...), nodes[max(0, len(nodes)-1)].Kind) &&
-		node.Kind == AST_NotEqual {
-		err := "Expected bool, identifier, number or string as RHS of equality"
-		return nil, char, nodes, &Error{err, 24}
-	} else if slices.Contains(AST_Bool, nodes[max(0, len(nodes)-1)].Kind) && node.Kind == AST_Not {
-		err := "Expected bool as RHS of `not`"
-		return nil, char, nodes, &Error{err, 24}
+	// `-128i8 ^ 2` is `-(128i8 ^ 2)`
+	if i+1 < len(p.Tokens) && p.Tokens[i+1].Kind == TOK_Pow {
+		return false
 	}
 
-	node.RHS = nodes[max(0, len(nodes)-1)]
-	nodes = nodes[:max(0, len(nodes)-1)]
+	if i < 2 {
+		return true
+	}
 
-	return node, char, nodes, nil
+	return !valueEnd(p.Tokens[i-2])
 }
 
-func (p *Parser) parseTypeOp(line string, char int, nodes []*ASTNode) (*ASTNode, int, []*ASTNode, *Error) {
+// parseInterp parses an interpolated string into its literal pieces, as
+// AST_String nodes, and embedded expressions, both in order in Children.
+func (p *Parser) parseInterp() (*ASTNode, *Diagnostic) {
+	tok := p.next()
+
 	node := &ASTNode{}
+	node.Kind = AST_Interp
+	node.Value = tok.Value
+	node.Raw = tok.Raw
+	node.Children = []*ASTNode{}
+
+	for _, part := range tok.Parts {
+		if part.Expr == nil {
+			if part.Text != "" {
+				node.Children = append(node.Children, &ASTNode{Kind: AST_String, Value: part.Text, Span: p.tokenSpan(tok)})
+			}
+
+			continue
+		}
+
+		sub := &Parser{
+			File:    p.File,
+			Context: AST_Group,
+			Fn:      p.Fn,
+			Tokens:  part.Expr,
+		}
 
-	if nodes != nil && nodes[max(0, len(nodes)-1)].Kind != AST_Id {
-		err := "Expected identifier as LHS of type cast or `typeOf`"
-		return nil, char, nodes, &Error{err, 24}
+		if sub.peek().Kind == TOK_EOF {
+			err := "Expected expression in `{}` of interpolated string"
+			return nil, &Diagnostic{
+				Code:    26,
+				Message: err,
+				Span:    p.tokenSpan(sub.peek()),
+				Notes:   []string{"use `\\{` for a literal `{`"},
+			}
+		}
+
+		expr, err := sub.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+
+		if end := sub.peek(); end.Kind != TOK_EOF {
+			err := fmt.Sprintf("Expected `}` after embedded expression, found %s", end.Kind)
+			return nil, &Diagnostic{Code: 29, Message: err, Span: sub.tokenSpan(end)}
+		}
+
+		p.Diags = append(p.Diags, sub.Diags...)
+		node.Children = append(node.Children, expr)
 	}
 
-	node.LHS = nodes[max(0, len(nodes)-1)]
-	nodes = nodes[:max(0, len(nodes)-1)]
+	node.Span = p.spanFrom(tok.Pos)
 
-	node.Kind = AST_TypeOf
-	char++
+	return node, nil
+}
 
-	if char >= len(line) || char < len(line) && line[char] != ':' {
-		err := "Expected another `:`"
-		return nil, char, nodes, &Error{err, 27}
+// parseIndex parses `[i]` into an AST_Index and `[lo:hi]` into an AST_Slice
+// of the list in LHS. A slice keeps its bounds in Params, either of which
+// may be empty.
+func (p *Parser) parseIndex(list *ASTNode) (*ASTNode, *Diagnostic) {
+	open := p.next()
+
+	node := &ASTNode{}
+	node.Kind = AST_Index
+	node.LHS = list
+
+	bounds := [][]*ASTNode{}
+
+	for {
+		bound := []*ASTNode{}
+
+		if kind := p.peek().Kind; kind != TOK_Colon && kind != TOK_RBrack {
+			expr, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
+			}
+
+			bound = append(bound, expr)
+		}
+
+		bounds = append(bounds, bound)
+
+		if p.peek().Kind != TOK_Colon || len(bounds) == 2 {
+			break
+		}
+
+		p.next()
 	}
 
-	char++
+	if tok := p.peek(); tok.Kind != TOK_RBrack {
+		err := fmt.Sprintf("Expected `]`, found %s", tok.Kind)
+		return nil, &Diagnostic{
+			Code:    28,
+			Message: err,
+			Span:    p.tokenSpan(tok),
+			Labels:  []Label{{p.tokenSpan(open), "index opened here"}},
+		}
+	}
+	p.next()
+
+	if len(bounds) == 2 {
+		node.Kind = AST_Slice
+		node.Params = bounds
+	} else if len(bounds[0]) == 0 {
+		err := "Expected index"
+		return nil, &Diagnostic{Code: 26, Message: err, Span: p.spanFrom(open.Pos)}
+	} else {
+		node.RHS = bounds[0][0]
+	}
+
+	node.Span = p.spanFrom(list.Span.Start)
 
-	for char < len(line) && unicode.IsSpace(rune(line[char])) {
-		char++
+	return node, nil
+}
+
+// parseListLit parses a list literal, its type followed by the elements in
+// braces, e.g. `[3]int{1, 2, 3}`. A list type on its own is kept as is, so
+// that it can be compared with `::x`.
+func (p *Parser) parseListLit() (*ASTNode, *Diagnostic) {
+	typ, err := p.parseType()
+	if err != nil {
+		return nil, err
 	}
 
-	if char < len(line) {
-		rhsStart := line[char:]
-		rhs, err, charInc := p.parse(1, &rhsStart)
+	open := p.peek()
+	if open.Kind != TOK_LBrace {
+		return typ, nil
+	}
+	p.next()
+
+	node := &ASTNode{}
+	node.Kind = AST_List
+	node.LHS = typ
+	node.Children = []*ASTNode{}
+
+	prevContext := p.Context
+	p.Context = AST_List
+	defer func() { p.Context = prevContext }()
+
+	for {
+		p.skipNewlines()
+
+		switch p.peek().Kind {
+		case TOK_EOF:
+			err := "Unexpected EOF in list"
+			p.Diags = append(p.Diags, &Diagnostic{
+				Code:    28,
+				Message: err,
+				Span:    p.tokenSpan(p.peek()),
+				Labels:  []Label{{p.tokenSpan(open), "list opened here"}},
+				Fixes:   []Fix{{p.tokenSpan(p.peek()), "}", "close the list"}},
+			})
+
+			node.Span = p.spanFrom(typ.Span.Start)
+			return node, nil
+		case TOK_RBrace:
+			p.next()
+			node.Span = p.spanFrom(typ.Span.Start)
+			return node, nil
+		}
+
+		startCursor := p.Cursor
+		elem, err := p.parseExpr(0)
 		if err != nil {
-			return nil, char, nodes, err
+			elem = p.recoverFrom(err, startCursor)
 		}
 
-		nodes = append(nodes, rhs[0])
+		node.Children = append(node.Children, elem)
+		p.skipNewlines()
+
+		switch tok := p.peek(); tok.Kind {
+		case TOK_Comma:
+			p.next()
+		case TOK_RBrace, TOK_EOF:
+		default:
+			err := fmt.Sprintf("Expected `,` or `}`, found %s", tok.Kind)
+			p.recoverFrom(&Diagnostic{Code: 28, Message: err, Span: p.tokenSpan(tok)}, p.Cursor)
+		}
+	}
+}
+
+// parseType parses a type, e.g. in a parameter or after `::`. That is a type
+// name, or a list type with `[N]T` for N elements of T or `[]T` for a dynamic
+// list of T.
+func (p *Parser) parseType() (*ASTNode, *Diagnostic) {
+	tok := p.peek()
 
-		if nodes != nil && nodes[max(0, len(nodes)-1)].Kind == AST_Id {
-			node.Kind = AST_TypeCast
+	if tok.Kind == TOK_LBrack {
+		p.next()
 
-			char += charInc
-			node.RHS = nodes[max(0, len(nodes)-1)]
-		} else if nodes != nil &&
-			!slices.Contains([]ASTKind{
-				AST_Equal,
-				AST_NotEqual,
-				AST_Greater,
-				AST_GreaterOrEqual,
-				AST_Lesser,
-				AST_LesserOrEqual,
-			}, nodes[max(0, len(nodes)-1)].Kind) {
-			err := "Expected identifier as RHS of type cast"
-			return nil, char, nodes, &Error{err, 24}
+		node := &ASTNode{}
+		node.Kind = AST_ListId
+
+		if p.peek().Kind != TOK_RBrack {
+			size, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
+			}
+
+			node.LHS = size
+		}
+
+		if end := p.peek(); end.Kind != TOK_RBrack {
+			err := fmt.Sprintf("Expected `]` in list type, found %s", end.Kind)
+			return nil, &Diagnostic{
+				Code:    28,
+				Message: err,
+				Span:    p.tokenSpan(end),
+				Labels:  []Label{{p.tokenSpan(tok), "list type opened here"}},
+			}
+		}
+		p.next()
+
+		elem, err := p.parseType()
+		if err != nil {
+			return nil, err
 		}
 
-		char--
-		nodes = nodes[:max(0, len(nodes)-1)]
+		node.RHS = elem
+		node.Span = p.spanFrom(tok.Pos)
+
+		return node, nil
 	}
 
-	return node, char, nodes, nil
-}
+	if tok.Kind != TOK_Id {
+		err := fmt.Sprintf("Expected type, found %s", tok.Kind)
+		return nil, &Diagnostic{Code: 24, Message: err, Span: p.tokenSpan(tok)}
+	}
+
+	p.next()
+
+	node := &ASTNode{}
+	node.Kind = AST_Id
+	node.Value = tok.Value
+	node.Span = p.spanFrom(tok.Pos)
 
-func (p *Parser) parseFn(line string, char int) (*ASTNode, int, *Error) {
-	p.Context = AST_Function
+	return node, nil
+}
 
+func (p *Parser) parseFn(start Position) (*ASTNode, *Diagnostic) {
 	node := &ASTNode{}
 	node.Kind = AST_Function
 
-	loc := line[char:]
-	name, err, newChar := p.parse(1, &loc)
-	if err != nil {
-		return nil, char, err
-	}
+	prevFn := p.Fn
+	p.Fn = node
+	defer func() { p.Fn = prevFn }()
 
-	if len(name) == 0 || name[0].Kind != AST_Id {
+	name := p.peek()
+	if name.Kind == TOK_Keyword && name.Value == "fn" {
+		err := "Expected function name after `fn` keyword"
+		return nil, &Diagnostic{Code: 63, Message: err, Span: p.tokenSpan(name)}
+	} else if name.Kind != TOK_Id {
 		err := "Expected identifier for function name"
-		return nil, char, &Error{err, 27}
+		return nil, &Diagnostic{Code: 27, Message: err, Span: p.tokenSpan(name)}
 	}
 
-	node.Value = name[0].Value
-	char += newChar
+	p.next()
+	node.Value = name.Value
 
-	for char < len(line) && unicode.IsSpace(rune(line[char])) {
-		char++
-	}
-
-	params, newChar, err := p.parseGroup(line, char)
+	params, err := p.parseParams()
 	if err != nil {
-		return nil, char, err
+		return nil, err
 	}
 
 	node.Params = params.Params
-	char = newChar
 
-	for char < len(line) && unicode.IsSpace(rune(line[char])) {
-		char++
+	if _, ok := returnArrows[p.peek().Kind]; ok {
+		ret, err := p.parseReturnType()
+		if err != nil {
+			return nil, err
+		}
+
+		node.RHS = ret
 	}
 
-	block, newChar, err := p.parseBlock(line, char)
+	block, err := p.parseBlock()
 	if err != nil {
-		return nil, char, err
+		return nil, err
 	}
 
 	node.Children = block.Children
-	char = newChar
+	node.Span = p.spanFrom(start)
+
+	return node, nil
+}
+
+var returnArrows = map[TokenKind]ASTKind{
+	TOK_ReturnOnly:   AST_ReturnOnly,
+	TOK_ReturnNil:    AST_ReturnNil,
+	TOK_ReturnErr:    AST_ReturnErr,
+	TOK_ReturnErrNil: AST_ReturnErrNil,
+}
+
+// parseReturnType parses the arrow after a function's parameters and the
+// returned type in its LHS. A second type, e.g. of the error for `!>`, may
+// follow after a comma and ends up in its RHS.
+func (p *Parser) parseReturnType() (*ASTNode, *Diagnostic) {
+	arrow := p.next()
+
+	node := &ASTNode{}
+	node.Kind = returnArrows[arrow.Kind]
+
+	typ, err := p.parseType()
+	if err != nil {
+		err.Message = fmt.Sprintf("Expected return type after %s", arrow.Kind)
+		return nil, err
+	}
+
+	node.LHS = typ
+
+	if p.peek().Kind == TOK_Comma {
+		p.next()
+
+		typ, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
 
-	p.Context = AST_Nil
+		node.RHS = typ
+	}
+
+	node.Span = p.spanFrom(arrow.Pos)
 
-	return node, char, nil
+	return node, nil
 }
 
-func (p *Parser) parseBlock(line string, char int) (*ASTNode, int, *Error) {
+func (p *Parser) parseBlock() (*ASTNode, *Diagnostic) {
 	node := &ASTNode{}
 	node.Kind = AST_Block
 	node.Children = []*ASTNode{}
+	open := p.peek()
+	start := open.Pos
 
-	if line[char] != '{' {
-		err := fmt.Sprintf("Invalid open block: %s", string(line[char]))
-		return nil, char, &Error{err, 28}
+	if open.Kind != TOK_LBrace {
+		err := fmt.Sprintf("Invalid open block: %s", open.Value)
+		return nil, &Diagnostic{Code: 28, Message: err, Span: p.tokenSpan(open)}
 	}
-	char++
+	p.next()
 
+	prevContext := p.Context
 	p.Context = AST_Block
+	defer func() { p.Context = prevContext }()
 
-	for char < len(line) && line[char] != '}' {
-		for char < len(line) && unicode.IsSpace(rune(line[char])) {
-			char++
+	for {
+		p.skipStmtEnds()
+
+		switch p.peek().Kind {
+		case TOK_EOF:
+			err := "Unexpected EOF in block"
+			p.Diags = append(p.Diags, &Diagnostic{
+				Code:    28,
+				Message: err,
+				Span:    p.tokenSpan(p.peek()),
+				Labels:  []Label{{p.tokenSpan(open), "block opened here"}},
+				Fixes:   []Fix{{p.tokenSpan(p.peek()), "}", "close the block"}},
+			})
+
+			node.Span = p.spanFrom(start)
+			return node, nil
+		case TOK_RBrace:
+			p.next()
+			node.Span = p.spanFrom(start)
+			return node, nil
 		}
 
-		if char >= len(line) {
-			if !p.Scanner.Scan() {
-				err := "Unexpected EOF in block"
-				return nil, char, &Error{err, 28}
-			}
-			line = p.Scanner.Text()
-			char = 0
-			continue
+		startCursor := p.Cursor
+		stmt, err := p.parseStmt()
+		if err != nil {
+			stmt = p.recoverFrom(err, startCursor)
 		}
 
-		if line[char] == '}' {
-			break
-		}
+		node.Children = append(node.Children, stmt)
+	}
+}
 
-		loc := line[char:]
-		nodes, err, newChar := p.parse(-1, &loc)
+// parseGroup parses a parenthesised, comma separated list of expressions.
+// Each expression is one entry of the node's Params.
+func (p *Parser) parseGroup() (*ASTNode, *Diagnostic) {
+	return p.parseList(AST_Group, func() ([]*ASTNode, *Diagnostic) {
+		expr, err := p.parseExpr(0)
 		if err != nil {
-			return nil, char, err
+			return nil, err
 		}
 
-		char += newChar
-
-		node.Children = append(node.Children, nodes...)
-	}
-
-	if char >= len(line) || line[char] != '}' {
-		err := "Missing closing `}` in block"
-		return nil, char, &Error{err, 28}
-	}
+		return []*ASTNode{expr}, nil
+	})
+}
 
-	for char < len(line) && unicode.IsSpace(rune(line[char])) {
-		char++
-	}
+// parseParams parses the parameters of a function signature, each of them
+// a `name type` pair in the node's Params.
+func (p *Parser) parseParams() (*ASTNode, *Diagnostic) {
+	return p.parseList(AST_Function, func() ([]*ASTNode, *Diagnostic) {
+		name := p.peek()
+		if name.Kind != TOK_Id {
+			err := "Expected name and type for function parameter"
+			return nil, &Diagnostic{
+				Code:    28,
+				Message: err,
+				Span:    p.tokenSpan(name),
+				Notes:   []string{"parameters are written as `name type`, e.g. `count int`"},
+			}
+		}
+		p.next()
 
-	p.Context = AST_Nil
-	char++
+		typ, err := p.parseType()
+		if err != nil {
+			err.Message = "Expected name and type for function parameter"
+			err.Code = 28
+			err.Notes = []string{"parameters are written as `name type`, e.g. `count int`"}
+			return nil, err
+		}
 
-	return node, char, nil
+		return []*ASTNode{{Kind: AST_Id, Value: name.Value, Span: p.tokenSpan(name)}, typ}, nil
+	})
 }
 
-func (p *Parser) parseGroup(line string, char int) (*ASTNode, int, *Error) {
+// parseList parses a parenthesised list of comma separated entries into an
+// AST_Group node, using context to decide where broken entries end.
+func (p *Parser) parseList(context ASTKind, parseEntry func() ([]*ASTNode, *Diagnostic)) (*ASTNode, *Diagnostic) {
 	node := &ASTNode{}
 	node.Kind = AST_Group
 	node.Params = [][]*ASTNode{}
+	open := p.peek()
+	start := open.Pos
 
-	if line[char] != '(' {
-		err := fmt.Sprintf("Invalid open group: %s", string(line[char]))
-		return nil, char, &Error{err, 28}
+	if open.Kind != TOK_LParen {
+		err := fmt.Sprintf("Invalid open group: %s", open.Value)
+		return nil, &Diagnostic{Code: 28, Message: err, Span: p.tokenSpan(open)}
 	}
-	char++
+	p.next()
 
-	if p.Context == AST_Nil {
-		p.Context = AST_Group
-	}
+	prevContext := p.Context
+	p.Context = context
+	defer func() { p.Context = prevContext }()
 
 	for {
-		for char < len(line) && unicode.IsSpace(rune(line[char])) {
-			char++
+		// The statement or block the group is in ends first, e.g. after
+		// recovering from a broken entry
+		if tok := p.peek(); tok.Kind == TOK_Newline || tok.Kind == TOK_RBrace {
+			err := fmt.Sprintf("Expected `)`, found %s", tok.Kind)
+			p.Diags = append(p.Diags, &Diagnostic{
+				Code:    28,
+				Message: err,
+				Span:    p.tokenSpan(tok),
+				Labels:  []Label{{p.tokenSpan(open), "group opened here"}},
+				Fixes:   []Fix{{p.tokenSpan(tok), ")", "close the group"}},
+			})
+
+			node.Span = p.spanFrom(start)
+			return node, nil
 		}
 
-		if char >= len(line) {
-			if !p.Scanner.Scan() {
-				err := "Unexpected EOF in group"
-				return nil, char, &Error{err, 28}
-			}
-
-			line = p.Scanner.Text()
-			char = 0
-			continue
+		switch p.peek().Kind {
+		case TOK_EOF:
+			err := "Unexpected EOF in group"
+			p.Diags = append(p.Diags, &Diagnostic{
+				Code:    28,
+				Message: err,
+				Span:    p.tokenSpan(p.peek()),
+				Labels:  []Label{{p.tokenSpan(open), "group opened here"}},
+				Fixes:   []Fix{{p.tokenSpan(p.peek()), ")", "close the group"}},
+			})
+
+			node.Span = p.spanFrom(start)
+			return node, nil
+		case TOK_RParen:
+			p.next()
+			node.Span = p.spanFrom(start)
+			return node, nil
 		}
 
-		if line[char] == ')' {
-			break
+		startCursor := p.Cursor
+		entry, err := parseEntry()
+		if err != nil {
+			entry = []*ASTNode{p.recoverFrom(err, startCursor)}
 		}
 
-		exprs := -1
-		if p.Context == AST_Function {
-			exprs = 2
+		node.Params = append(node.Params, entry)
+
+		switch tok := p.peek(); tok.Kind {
+		case TOK_Comma:
+			p.next()
+		case TOK_RParen, TOK_EOF, TOK_Newline, TOK_RBrace:
+		case TOK_Bad:
+			// The lexer has reported it already
+			p.recoverFrom(errReported, p.Cursor)
+		default:
+			err := fmt.Sprintf("Expected `,` or `)`, found %s", tok.Kind)
+			p.recoverFrom(&Diagnostic{Code: 28, Message: err, Span: p.tokenSpan(tok)}, p.Cursor)
 		}
+	}
+}
 
-		loc := line[char:]
-		param, err, newChar := p.parse(exprs, &loc)
-		if err != nil {
-			return nil, char, err
+func (p *Parser) peek() Token {
+	return p.Tokens[min(p.Cursor, len(p.Tokens)-1)]
+}
+
+func (p *Parser) next() Token {
+	tok := p.peek()
+
+	if p.Cursor < len(p.Tokens)-1 {
+		p.Cursor++
+	}
+
+	return tok
+}
+
+// recoverFrom records err and skips the rest of the broken statement, up to the
+// next newline or `;`, or the delimiter closing the surrounding block or group
+// on the same nesting level. In a group it also stops before a newline or `}`
+// that ends the statement or block the group is in, so an unclosed group
+// doesn't swallow them. The skipped source, starting at the token at
+// startCursor, becomes an AST_Bad node.
+func (p *Parser) recoverFrom(err *Diagnostic, startCursor int) *ASTNode {
+	if err != errReported {
+		p.Diags = append(p.Diags, err)
+	}
+
+	// Recovery ends at stops, or before ends, which belong to what
+	// encloses the broken part
+	stops := []TokenKind{TOK_Newline, TOK_Semi}
+	ends := []TokenKind{}
+	switch p.Context {
+	case AST_Block:
+		stops = []TokenKind{TOK_Newline, TOK_Semi, TOK_RBrace}
+	case AST_Group, AST_Function:
+		stops = []TokenKind{TOK_Comma, TOK_RParen}
+		ends = []TokenKind{TOK_Newline, TOK_RBrace}
+	case AST_List:
+		stops = []TokenKind{TOK_Comma, TOK_RBrace}
+	}
+
+	depth := 0
+	for tok := p.peek(); tok.Kind != TOK_EOF; tok = p.peek() {
+		if depth == 0 && slices.Contains(ends, tok.Kind) {
+			break
 		}
 
-		if p.Context == AST_Function &&
-			(len(param) != 2 ||
-				(len(param) == 2 &&
-					(param[0].Kind != AST_Id || param[1].Kind != AST_Id))) {
-			err := "Expected name and type for function parameter"
-			return nil, char, &Error{err, 28}
+		if depth == 0 && slices.Contains(stops, tok.Kind) {
+			// Always move on, even if the error was on the delimiter itself
+			if p.Cursor == startCursor {
+				p.next()
+			}
+
+			break
 		}
 
-		for char < len(line) && unicode.IsSpace(rune(line[char])) {
-			char++
+		switch tok.Kind {
+		case TOK_LBrace, TOK_LParen, TOK_LBrack:
+			depth++
+		case TOK_RBrace, TOK_RParen, TOK_RBrack:
+			depth = max(depth-1, 0)
 		}
 
-		char += newChar
+		p.next()
+	}
+
+	return &ASTNode{
+		Kind: AST_Bad,
+		Span: p.spanFrom(p.Tokens[startCursor].Pos),
+	}
+}
+
+// spanFrom returns the span from start to the end of the last consumed token.
+func (p *Parser) spanFrom(start Position) Span {
+	end := start
+	if p.Cursor > 0 && p.Tokens[p.Cursor-1].End.Offset > start.Offset {
+		end = p.Tokens[p.Cursor-1].End
+	}
 
-		node.Params = append(node.Params, param)
+	return Span{
+		File:  p.File,
+		Start: start,
+		End:   end,
 	}
+}
+
+func (p *Parser) tokenSpan(tok Token) Span {
+	return Span{File: p.File, Start: tok.Pos, End: tok.End}
+}
 
-	if char >= len(line) || line[char] != ')' {
-		err := "Missing closing `)` in group"
-		return nil, char, &Error{err, 28}
+// skipStmtEnds moves over the newlines and `;` between statements.
+func (p *Parser) skipStmtEnds() {
+	for kind := p.peek().Kind; kind == TOK_Newline || kind == TOK_Semi; kind = p.peek().Kind {
+		p.next()
 	}
+}
 
-	p.Context = AST_Nil
-	char++
+func (p *Parser) skipNewlines() {
+	for p.peek().Kind == TOK_Newline {
+		p.next()
+	}
+}
+
+// atStmtEnd reports whether the statement being parsed ends before the next
+// token.
+func (p *Parser) atStmtEnd() bool {
+	kind := p.peek().Kind
+	return p.atLineEnd() || kind == TOK_Semi || p.Context == AST_Block && kind == TOK_RBrace
+}
 
-	return node, char, nil
+func (p *Parser) atLineEnd() bool {
+	kind := p.peek().Kind
+	return kind == TOK_Newline || kind == TOK_EOF
 }
@@ -0,0 +1,166 @@
+package include
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with the file at path, or writes it there with -update.
+func golden(t *testing.T, path, got string) {
+	t.Helper()
+
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s, run the tests with -update to create it", err)
+	}
+
+	if got != string(want) {
+		t.Errorf("%s differs:\n--- got ---\n%s\n--- want ---\n%s", path, got, want)
+	}
+}
+
+// parseTestdata parses each file of testdata/parse, calling f with its path
+// without the extension.
+func parseTestdata(t *testing.T, f func(t *testing.T, base string, file *File)) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "parse", "*.wp"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no test files: %v", err)
+	}
+
+	for _, path := range paths {
+		base := strings.TrimSuffix(path, ".wp")
+		t.Run(filepath.Base(base), func(t *testing.T) {
+			src, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f(t, base, ParseString(filepath.Base(path), string(src), nil))
+		})
+	}
+}
+
+// TestParseSexpr checks the S-expression of each file and its diagnostics
+// against the .sexp golden files.
+func TestParseSexpr(t *testing.T) {
+	parseTestdata(t, func(t *testing.T, base string, file *File) {
+		var out strings.Builder
+		for _, diag := range file.Diags {
+			fmt.Fprintf(&out, "%s: E%03d %s\n", diag.Span, diag.Code, diag.Message)
+		}
+
+		out.WriteString(Sexpr(file.Root) + "\n")
+		golden(t, base+".sexp", out.String())
+	})
+}
+
+func TestParseJSON(t *testing.T) {
+	parseTestdata(t, func(t *testing.T, base string, file *File) {
+		var out bytes.Buffer
+		if err := WriteJSON(&out, file.Root); err != nil {
+			t.Fatal(err)
+		}
+
+		golden(t, base+".json", out.String())
+	})
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	parseTestdata(t, func(t *testing.T, base string, file *File) {
+		var out bytes.Buffer
+		if err := WriteJSON(&out, file.Root); err != nil {
+			t.Fatal(err)
+		}
+
+		root, err := ReadJSON(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := Sexpr(root), Sexpr(file.Root); got != want {
+			t.Errorf("ReadJSON(WriteJSON(tree)):\n got %s\nwant %s", got, want)
+		}
+	})
+}
+
+func TestFprint(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"f(1)\nif x {y++} else {}", `Program @1:1
+  Stmts[0]: ExprStmt @1:1
+    X: CallExpr @1:1
+      Fn: Ident "f" @1:1
+      Args[0]: Literal Integer "1" @1:3
+  Stmts[1]: IfStmt @2:1
+    Cond: Ident "x" @2:4
+    Body: Block @2:6
+      Stmts[0]: IncDecStmt Increment @2:7
+        X: Ident "y" @2:7
+    Else: Block @2:17
+`},
+		// A broken parameter doesn't convert, so the raw fields are printed
+		{"fn f(a) {}", `Root @1:1
+  Function Declaration "f" @1:1
+    Params[0]: Error @1:6
+`},
+	}
+
+	for _, test := range tests {
+		var out strings.Builder
+		if err := Fprint(&out, ParseString("test.wp", test.src, nil).Root); err != nil {
+			t.Fatal(err)
+		}
+
+		if out.String() != test.want {
+			t.Errorf("Fprint(%q):\n got %s\nwant %s", test.src, out.String(), test.want)
+		}
+	}
+}
+
+func TestTypedTreeRoundTrip(t *testing.T) {
+	parseTestdata(t, func(t *testing.T, base string, file *File) {
+		// A broken parameter has no place in a FuncDecl
+		if len(file.Diags) > 0 {
+			t.Skip("the file has errors")
+		}
+
+		node, err := FromAST(file.Root)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := Sexpr(ToAST(node)), Sexpr(file.Root); got != want {
+			t.Errorf("ToAST(FromAST(tree)):\n got %s\nwant %s", got, want)
+		}
+
+		// Spans and the fields Sexpr leaves out have to survive too
+		var got, want bytes.Buffer
+		if err := WriteJSON(&got, ToAST(node)); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteJSON(&want, file.Root); err != nil {
+			t.Fatal(err)
+		}
+
+		if got.String() != want.String() {
+			t.Errorf("ToAST(FromAST(tree)) differs from the tree in JSON:\n got %s\nwant %s", got.String(), want.String())
+		}
+	})
+}
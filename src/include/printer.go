@@ -0,0 +1,335 @@
+package include
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//====== Tree ======//
+
+// Fprint writes the tree under node, a node per line and indented by depth.
+// Each line gives the field the node hangs off, its type in the typed tree,
+// its kind and value, and where it starts:
+//
+//	Program @1:1
+//	  Stmts[0]: VarDecl @1:1
+//	    Name: Ident "x" @1:1
+//	    Value: Literal Integer "1" @1:6
+//
+// A tree that FromAST can't convert, such as one with a parameter that failed
+// to parse, is printed by the LHS, RHS, Alt, Params and Children of its
+// ASTNodes instead.
+func Fprint(w io.Writer, node *ASTNode) error {
+	pw := &printer{w: w}
+
+	if typed, err := FromAST(node); err == nil && typed != nil {
+		pw.node(reflect.ValueOf(typed), "", 0)
+	} else {
+		pw.tree(node, "", 0)
+	}
+
+	return pw.err
+}
+
+type printer struct {
+	w   io.Writer
+	err error
+}
+
+func (pw *printer) printf(format string, args ...any) {
+	if pw.err == nil {
+		_, pw.err = fmt.Fprintf(pw.w, format, args...)
+	}
+}
+
+var (
+	nodeType    = reflect.TypeFor[Node]()
+	astKindType = reflect.TypeFor[ASTKind]()
+)
+
+// node prints the typed node held by val, then the nodes in its fields. The
+// kinds, strings and set flags among its fields go on its own line. Raw and
+// Doc are left out, like the decoded Int and Float of a literal.
+func (pw *printer) node(val reflect.Value, field string, depth int) {
+	if val.Kind() == reflect.Interface {
+		val = val.Elem()
+	}
+
+	if !val.IsValid() || val.IsNil() {
+		return
+	}
+
+	elem := val.Elem()
+	pw.printf("%s%s%s", strings.Repeat("  ", depth), field, elem.Type().Name())
+
+	for i := range elem.NumField() {
+		name, value := elem.Type().Field(i).Name, elem.Field(i)
+
+		switch {
+		case name == "Raw" || name == "Doc":
+		case value.Type() == astKindType:
+			pw.printf(" %s", value.Interface())
+		case name == "Suffix" && value.String() != "":
+			pw.printf(" (%s)", value.String())
+		case value.Kind() == reflect.String && value.String() != "":
+			pw.printf(" %q", value.String())
+		case value.Kind() == reflect.Bool && value.Bool():
+			pw.printf(" %s", name)
+		}
+	}
+
+	pw.printf(" @%s\n", val.Interface().(Node).NodeSpan().Start)
+
+	for i := range elem.NumField() {
+		name, value := elem.Type().Field(i).Name, elem.Field(i)
+
+		switch {
+		case value.Type().Implements(nodeType):
+			pw.node(value, name+": ", depth+1)
+		case value.Kind() == reflect.Slice && value.Type().Elem().Implements(nodeType):
+			for j := range value.Len() {
+				pw.node(value.Index(j), fmt.Sprintf("%s[%d]: ", name, j), depth+1)
+			}
+		}
+	}
+}
+
+// tree prints an ASTNode and the nodes under it by their raw fields.
+func (pw *printer) tree(node *ASTNode, field string, depth int) {
+	if node == nil {
+		return
+	}
+
+	pw.printf("%s%s%s", strings.Repeat("  ", depth), field, node.Kind)
+	if node.Value != "" {
+		pw.printf(" %q", node.Value)
+	}
+	if node.Suffix != "" {
+		pw.printf(" (%s)", node.Suffix)
+	}
+	pw.printf(" @%s\n", node.Span.Start)
+
+	pw.tree(node.LHS, "LHS: ", depth+1)
+	pw.tree(node.RHS, "RHS: ", depth+1)
+	pw.tree(node.Alt, "Alt: ", depth+1)
+
+	for i, param := range node.Params {
+		for _, child := range param {
+			pw.tree(child, fmt.Sprintf("Params[%d]: ", i), depth+1)
+		}
+	}
+
+	for _, child := range node.Children {
+		pw.tree(child, "", depth+1)
+	}
+}
+
+//====== S-expressions ======//
+
+// Sexpr renders the tree under node as an S-expression. A node is its kind,
+// in lower case and joined by `-`, then its value, LHS and RHS, any Alt and
+// Params behind `:alt` and `:params`, and its children:
+//
+//	(variable-declaration (identifier "x") (integer "1"))
+//
+// A missing LHS is written `()` if there is an RHS.
+func Sexpr(node *ASTNode) string {
+	out := strings.Builder{}
+	sexpr(&out, node)
+	return out.String()
+}
+
+func sexpr(out *strings.Builder, node *ASTNode) {
+	if node == nil {
+		out.WriteString("()")
+		return
+	}
+
+	out.WriteString("(" + strings.ReplaceAll(strings.ToLower(node.Kind.String()), " ", "-"))
+
+	if node.Value != "" {
+		out.WriteString(" " + strconv.Quote(node.Value))
+	}
+
+	if node.LHS != nil || node.RHS != nil {
+		out.WriteByte(' ')
+		sexpr(out, node.LHS)
+	}
+
+	if node.RHS != nil {
+		out.WriteByte(' ')
+		sexpr(out, node.RHS)
+	}
+
+	if node.Alt != nil {
+		out.WriteString(" :alt ")
+		sexpr(out, node.Alt)
+	}
+
+	if len(node.Params) > 0 {
+		out.WriteString(" :params")
+
+		for _, param := range node.Params {
+			out.WriteString(" (")
+			for i, child := range param {
+				if i > 0 {
+					out.WriteByte(' ')
+				}
+
+				sexpr(out, child)
+			}
+			out.WriteByte(')')
+		}
+	}
+
+	for _, child := range node.Children {
+		out.WriteByte(' ')
+		sexpr(out, child)
+	}
+
+	out.WriteByte(')')
+}
+
+//====== JSON ======//
+
+// jsonNode is the JSON form of an ASTNode, with its kind by name.
+type jsonNode struct {
+	Kind     string        `json:"kind"`
+	Value    string        `json:"value,omitempty"`
+	Raw      string        `json:"raw,omitempty"`
+	Doc      string        `json:"doc,omitempty"`
+	Int      uint64        `json:"int,omitempty"`
+	Float    float64       `json:"float,omitempty"`
+	Suffix   string        `json:"suffix,omitempty"`
+	Span     Span          `json:"span"`
+	LHS      *jsonNode     `json:"lhs,omitempty"`
+	RHS      *jsonNode     `json:"rhs,omitempty"`
+	Alt      *jsonNode     `json:"alt,omitempty"`
+	Params   [][]*jsonNode `json:"params,omitempty"`
+	Children []*jsonNode   `json:"children,omitempty"`
+}
+
+// WriteJSON writes the tree under node as indented JSON, which ReadJSON reads
+// back.
+func WriteJSON(w io.Writer, node *ASTNode) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(toJSON(node))
+}
+
+// ReadJSON reads a tree written by WriteJSON.
+func ReadJSON(r io.Reader) (*ASTNode, error) {
+	var root *jsonNode
+	if err := json.NewDecoder(r).Decode(&root); err != nil {
+		return nil, err
+	}
+
+	return fromJSON(root)
+}
+
+func toJSON(node *ASTNode) *jsonNode {
+	if node == nil {
+		return nil
+	}
+
+	out := &jsonNode{
+		Kind:   node.Kind.String(),
+		Value:  node.Value,
+		Raw:    node.Raw,
+		Doc:    node.Doc,
+		Int:    node.Int,
+		Float:  node.Float,
+		Suffix: node.Suffix,
+		Span:   node.Span,
+		LHS:    toJSON(node.LHS),
+		RHS:    toJSON(node.RHS),
+		Alt:    toJSON(node.Alt),
+	}
+
+	for _, param := range node.Params {
+		jsonParam := []*jsonNode{}
+		for _, child := range param {
+			jsonParam = append(jsonParam, toJSON(child))
+		}
+
+		out.Params = append(out.Params, jsonParam)
+	}
+
+	for _, child := range node.Children {
+		out.Children = append(out.Children, toJSON(child))
+	}
+
+	return out
+}
+
+func fromJSON(in *jsonNode) (*ASTNode, error) {
+	if in == nil {
+		return nil, nil
+	}
+
+	kind, ok := astKinds[in.Kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown node kind %q at %s", in.Kind, in.Span)
+	}
+
+	node := &ASTNode{
+		Kind:   kind,
+		Value:  in.Value,
+		Raw:    in.Raw,
+		Doc:    in.Doc,
+		Int:    in.Int,
+		Float:  in.Float,
+		Suffix: in.Suffix,
+		Span:   in.Span,
+	}
+
+	var err error
+	if node.LHS, err = fromJSON(in.LHS); err != nil {
+		return nil, err
+	}
+	if node.RHS, err = fromJSON(in.RHS); err != nil {
+		return nil, err
+	}
+	if node.Alt, err = fromJSON(in.Alt); err != nil {
+		return nil, err
+	}
+
+	for _, jsonParam := range in.Params {
+		param := []*ASTNode{}
+		for _, jsonChild := range jsonParam {
+			child, err := fromJSON(jsonChild)
+			if err != nil {
+				return nil, err
+			}
+
+			param = append(param, child)
+		}
+
+		node.Params = append(node.Params, param)
+	}
+
+	for _, jsonChild := range in.Children {
+		child, err := fromJSON(jsonChild)
+		if err != nil {
+			return nil, err
+		}
+
+		node.Children = append(node.Children, child)
+	}
+
+	return node, nil
+}
+
+// astKinds maps the names in astName back to their kinds.
+var astKinds = func() map[string]ASTKind {
+	kinds := map[string]ASTKind{}
+	for kind, name := range astName {
+		kinds[name] = kind
+	}
+
+	return kinds
+}()
@@ -1 +1,970 @@
 package include
+
+import (
+	"fmt"
+	"go/constant"
+	"slices"
+	"strings"
+)
+
+//====== Scopes ======//
+
+type SymbolKind int
+
+const (
+	SYM_Var   SymbolKind = iota // x := ...
+	SYM_Const                   // x #= ...
+	SYM_Param                   // fn f(x int)
+	SYM_Func                    // fn f()
+	SYM_Type                    // int
+)
+
+// Symbol is a declared name. Decl is the node that declares it, nil for the
+// built-in ones.
+type Symbol struct {
+	Name string
+	Kind SymbolKind
+	Type Type
+	Decl *ASTNode
+}
+
+// Scope holds the names declared in a block, looking up any others in its
+// Parent.
+type Scope struct {
+	Parent  *Scope
+	Symbols map[string]*Symbol
+}
+
+func NewScope(parent *Scope) *Scope {
+	return &Scope{Parent: parent, Symbols: map[string]*Symbol{}}
+}
+
+// Lookup finds name in the scope or the closest of its parents.
+func (s *Scope) Lookup(name string) *Symbol {
+	for ; s != nil; s = s.Parent {
+		if sym, ok := s.Symbols[name]; ok {
+			return sym
+		}
+	}
+
+	return nil
+}
+
+//====== Checker ======//
+
+// Info is what the checker learns about a tree: the type of every
+// expression, the value of every constant one, the conversion every `::`
+// cast does, and the symbol every name declares or refers to.
+type Info struct {
+	Types       map[*ASTNode]Type
+	Values      map[*ASTNode]constant.Value
+	Conversions map[*ASTNode]Conversion
+	Defs        map[*ASTNode]*Symbol
+	Uses        map[*ASTNode]*Symbol
+}
+
+type Checker struct {
+	Src   string
+	Scope *Scope
+	Fn    *Signature
+	Info  *Info
+	Diags []*Diagnostic
+}
+
+// Check type-checks a parsed file, returning what it learnt and a diagnostic
+// for each type error, sorted by position.
+func Check(file *File) (*Info, []*Diagnostic) {
+	c := &Checker{
+		Src:   file.Src,
+		Scope: NewScope(Universe),
+		Info: &Info{
+			Types:       map[*ASTNode]Type{},
+			Values:      map[*ASTNode]constant.Value{},
+			Conversions: map[*ASTNode]Conversion{},
+			Defs:        map[*ASTNode]*Symbol{},
+			Uses:        map[*ASTNode]*Symbol{},
+		},
+	}
+
+	c.stmts(file.Root.Children)
+
+	slices.SortStableFunc(c.Diags, func(a, b *Diagnostic) int {
+		return a.Span.Start.Offset - b.Span.Start.Offset
+	})
+
+	return c.Info, c.Diags
+}
+
+func (c *Checker) report(code int, span Span, err string) {
+	c.Diags = append(c.Diags, &Diagnostic{Code: code, Message: err, Span: span})
+}
+
+// declare adds a symbol to the current scope for the name in the Value of
+// node, an identifier or function.
+func (c *Checker) declare(name *ASTNode, kind SymbolKind, typ Type, decl *ASTNode) *Symbol {
+	sym := &Symbol{Name: name.Value, Kind: kind, Type: typ, Decl: decl}
+
+	if prev, ok := c.Scope.Symbols[name.Value]; ok && prev.Decl != nil {
+		err := fmt.Sprintf("`%s` is already declared in this scope", name.Value)
+		c.Diags = append(c.Diags, &Diagnostic{
+			Code:    46,
+			Message: err,
+			Span:    name.Span,
+			Labels:  []Label{{prev.Decl.Span, "first declared here"}},
+		})
+	}
+
+	c.Scope.Symbols[name.Value] = sym
+	c.Info.Defs[name] = sym
+	return sym
+}
+
+func (c *Checker) openScope() func() {
+	c.Scope = NewScope(c.Scope)
+	return func() { c.Scope = c.Scope.Parent }
+}
+
+//====== Statements ======//
+
+// stmts checks a list of statements in the current scope. Functions are
+// declared first, so they can be called above where they are written.
+func (c *Checker) stmts(nodes []*ASTNode) {
+	for _, node := range nodes {
+		if node.Kind == AST_Function {
+			sig := c.signature(node)
+			c.Info.Types[node] = sig
+			c.declare(node, SYM_Func, sig, node)
+		}
+	}
+
+	for _, node := range nodes {
+		c.stmt(node)
+	}
+}
+
+func (c *Checker) stmt(node *ASTNode) {
+	switch node.Kind {
+	case AST_Bad:
+	case AST_Variable:
+		c.declare(node.LHS, SYM_Var, c.infer(node), node)
+	case AST_Constant:
+		c.constDecl(node)
+	case AST_Assign:
+		c.assign(node)
+	case AST_Inc, AST_Dec:
+		if typ := c.expr(node.LHS); !isNumeric(typ) && !isInvalid(typ) {
+			err := fmt.Sprintf("Operator %s needs a number, found `%s`", node.Kind, typ)
+			c.report(42, node.LHS.Span, err)
+		}
+
+		c.target(node.LHS)
+	case AST_If:
+		c.cond(node.LHS)
+		c.stmt(node.RHS)
+
+		if node.Alt != nil {
+			c.stmt(node.Alt.LHS)
+		}
+	case AST_While:
+		c.cond(node.LHS)
+		c.stmt(node.RHS)
+	case AST_For:
+		defer c.openScope()()
+
+		if node.LHS != nil && node.LHS.Kind == AST_Group && len(node.LHS.Params) == 3 {
+			clauses := node.LHS.Params
+			for _, clause := range clauses[0] {
+				c.stmt(clause)
+			}
+			for _, cond := range clauses[1] {
+				c.cond(cond)
+			}
+			for _, clause := range clauses[2] {
+				c.stmt(clause)
+			}
+		} else if node.LHS != nil {
+			c.cond(node.LHS)
+		}
+
+		c.stmt(node.RHS)
+	case AST_Return:
+		c.returnStmt(node)
+	case AST_Exit:
+	case AST_ExitCode, AST_ExitNow:
+		if typ := c.defaultExpr(node.LHS); !isInteger(typ) && !isInvalid(typ) {
+			err := fmt.Sprintf("Expected integer exit code, found `%s`", typ)
+			c.report(31, node.LHS.Span, err)
+		}
+	case AST_Block:
+		defer c.openScope()()
+		c.stmts(node.Children)
+	case AST_Function:
+		c.function(node)
+	default:
+		c.defaultExpr(node)
+	}
+}
+
+// infer finds the type of the name declared by `x := value`, the type of the
+// value with untyped constants given their default type.
+func (c *Checker) infer(node *ASTNode) Type {
+	typ := c.defaultExpr(node.RHS)
+
+	switch {
+	case isBasic(typ, TYP_Void):
+		err := fmt.Sprintf("Expected a value, but %s returns nothing", describe(node.RHS))
+		c.report(42, node.RHS.Span, err)
+	case isBasic(typ, TYP_Nil):
+		err := fmt.Sprintf("Can't infer the type of `%s` from `nil`", node.LHS.Value)
+		c.Diags = append(c.Diags, &Diagnostic{
+			Code:    54,
+			Message: err,
+			Span:    node.RHS.Span,
+			Notes:   []string{"start it as an empty list instead, e.g. `[]int{}`"},
+		})
+	default:
+		return typ
+	}
+
+	return Typ[TYP_Invalid]
+}
+
+func (c *Checker) cond(node *ASTNode) {
+	if typ := c.expr(node); !isBasic(typ, TYP_Bool, TYP_Invalid) {
+		err := fmt.Sprintf("Expected `bool` condition, found `%s`", typ)
+		c.report(48, node.Span, err)
+	}
+}
+
+func (c *Checker) assign(node *ASTNode) {
+	to := c.expr(node.LHS)
+	from := c.expr(node.RHS)
+
+	if !c.target(node.LHS) {
+		return
+	}
+
+	if !c.assignable(node.RHS, to) {
+		err := fmt.Sprintf("Can't assign `%s` to %s of type `%s`", from, describe(node.LHS), to)
+		c.report(49, node.RHS.Span, err)
+	}
+}
+
+// target reports whether node can be assigned to, reporting it if not.
+func (c *Checker) target(node *ASTNode) bool {
+	root := node
+	for root.Kind == AST_Index || root.Kind == AST_Member {
+		root = root.LHS
+	}
+
+	if sym := c.Info.Uses[root]; root.Kind == AST_Id && sym != nil && sym.Kind == SYM_Const {
+		err := fmt.Sprintf("Can't change constant `%s`", sym.Name)
+		c.Diags = append(c.Diags, &Diagnostic{
+			Code:    49,
+			Message: err,
+			Span:    node.Span,
+			Labels:  []Label{{sym.Decl.Span, "declared as a constant here"}},
+			Notes:   []string{"declare it with `:=` to make it a variable"},
+		})
+		return false
+	}
+
+	switch node.Kind {
+	case AST_Id:
+		sym := c.Info.Uses[node]
+		if sym == nil || sym.Kind == SYM_Var || sym.Kind == SYM_Param {
+			return true
+		}
+	case AST_Index:
+		return true
+	case AST_Member:
+		return true
+	}
+
+	err := fmt.Sprintf("Can't assign to %s", describe(node))
+	c.report(49, node.Span, err)
+	return false
+}
+
+func (c *Checker) returnStmt(node *ASTNode) {
+	if c.Fn == nil {
+		return
+	}
+
+	if node.LHS == nil {
+		if c.Fn.Arrow == AST_ReturnOnly || c.Fn.Arrow == AST_ReturnErr {
+			err := fmt.Sprintf("Missing return value of type `%s`", c.Fn.Result)
+			c.report(47, node.Span, err)
+		}
+
+		return
+	}
+
+	typ := c.expr(node.LHS)
+
+	switch {
+	case c.Fn.Arrow == AST_Bad:
+		// The parser has reported it already
+	case c.assignable(node.LHS, c.Fn.Result):
+	case c.Fn.Err != nil && c.assignable(node.LHS, c.Fn.Err):
+	case isBasic(typ, TYP_Nil) && (c.Fn.Arrow == AST_ReturnNil || c.Fn.Arrow == AST_ReturnErrNil):
+	default:
+		err := fmt.Sprintf("Can't return `%s` from a function returning `%s`", typ, c.Fn.Result)
+		c.report(47, node.LHS.Span, err)
+	}
+}
+
+// signature resolves the type of a function from its parameters and return
+// arrow. A parameter that failed to parse is of the invalid type.
+func (c *Checker) signature(node *ASTNode) *Signature {
+	sig := &Signature{Arrow: AST_Bad}
+
+	for _, param := range node.Params {
+		if !isParam(param) {
+			sig.Params = append(sig.Params, Typ[TYP_Invalid])
+			continue
+		}
+
+		sig.Params = append(sig.Params, c.resolveType(param[1]))
+	}
+
+	if ret := node.RHS; ret != nil {
+		sig.Arrow = ret.Kind
+		sig.Result = c.resolveType(ret.LHS)
+
+		if ret.RHS != nil {
+			sig.Err = c.resolveType(ret.RHS)
+		}
+	}
+
+	return sig
+}
+
+func (c *Checker) function(node *ASTNode) {
+	sig := c.Info.Types[node].(*Signature)
+
+	prevFn := c.Fn
+	c.Fn = sig
+	defer func() { c.Fn = prevFn }()
+	defer c.openScope()()
+
+	for i, param := range node.Params {
+		if isParam(param) {
+			c.declare(param[0], SYM_Param, sig.Params[i], param[0])
+		}
+	}
+
+	c.stmts(node.Children)
+}
+
+// isParam reports whether an entry of a function's Params is the `name type`
+// pair of a parameter that parsed.
+func isParam(param []*ASTNode) bool {
+	return len(param) == 2 && param[0].Kind == AST_Id
+}
+
+//====== Types of names ======//
+
+// resolveType finds the type a type expression such as `int` or `[]f64`
+// names.
+func (c *Checker) resolveType(node *ASTNode) Type {
+	switch node.Kind {
+	case AST_Bad:
+		return Typ[TYP_Invalid]
+	case AST_Id:
+		sym := c.Scope.Lookup(node.Value)
+		if sym == nil || sym.Kind != SYM_Type {
+			err := fmt.Sprintf("Unknown type `%s`", node.Value)
+			c.report(50, node.Span, err)
+			return Typ[TYP_Invalid]
+		}
+
+		c.Info.Uses[node] = sym
+		return sym.Type
+	case AST_ListId:
+		elem := c.resolveType(node.RHS)
+		if node.LHS == nil {
+			return &List{Len: -1, Elem: elem}
+		}
+
+		c.defaultExpr(node.LHS)
+
+		length, ok := constant.Int64Val(constant.ToInt(c.Info.Values[node.LHS]))
+		if !ok || length < 0 {
+			err := "Expected a constant integer length for the list type"
+			c.report(50, node.LHS.Span, err)
+			return Typ[TYP_Invalid]
+		}
+
+		return &List{Len: int(length), Elem: elem}
+	}
+
+	err := fmt.Sprintf("Expected a type, found %s", node.Kind)
+	c.report(50, node.Span, err)
+	return Typ[TYP_Invalid]
+}
+
+//====== Expressions ======//
+
+// expr checks an expression, recording and returning its type, and its value
+// if it is constant.
+func (c *Checker) expr(node *ASTNode) Type {
+	typ := c.exprType(node)
+	c.Info.Types[node] = typ
+
+	if val := c.constant(node, typ); val != nil {
+		c.Info.Values[node] = val
+	}
+
+	return typ
+}
+
+func (c *Checker) exprType(node *ASTNode) Type {
+	switch node.Kind {
+	case AST_Bad:
+		return Typ[TYP_Invalid]
+	case AST_Int, AST_Hex, AST_Octal, AST_Binary, AST_Float, AST_String, AST_Char, AST_True, AST_False, AST_Nil, AST_TypeValue:
+		return LiteralType(node.Kind, node.Suffix)
+	case AST_Interp:
+		for _, part := range node.Children {
+			c.embedded(part)
+		}
+
+		return Typ[TYP_String]
+	case AST_Id:
+		sym := c.Scope.Lookup(node.Value)
+		if sym == nil {
+			err := fmt.Sprintf("Undefined name `%s`", node.Value)
+			c.report(40, node.Span, err)
+			return Typ[TYP_Invalid]
+		}
+
+		c.Info.Uses[node] = sym
+		if sym.Kind == SYM_Type {
+			err := fmt.Sprintf("Type `%s` used as a value", node.Value)
+			c.report(42, node.Span, err)
+			return Typ[TYP_Invalid]
+		}
+
+		return sym.Type
+	case AST_TypeOf:
+		if typ := c.defaultExpr(node.LHS); isBasic(typ, TYP_Void) {
+			err := fmt.Sprintf("Expected a value, but %s returns nothing", describe(node.LHS))
+			c.report(42, node.LHS.Span, err)
+			return Typ[TYP_Invalid]
+		}
+
+		return Typ[TYP_Type]
+	case AST_TypeCast:
+		return c.cast(node)
+	case AST_Call:
+		return c.call(node)
+	case AST_Member:
+		typ := c.expr(node.LHS)
+		if !isInvalid(typ) {
+			err := fmt.Sprintf("`%s` has no member `%s`", typ, node.Value)
+			c.report(52, node.Span, err)
+		}
+
+		return Typ[TYP_Invalid]
+	case AST_Index:
+		return c.index(node)
+	case AST_Slice:
+		return c.slice(node)
+	case AST_Group:
+		if len(node.Params) != 1 {
+			for _, param := range node.Params {
+				c.expr(param[0])
+			}
+
+			err := fmt.Sprintf("Expected a single value in parentheses, found %d", len(node.Params))
+			c.report(53, node.Span, err)
+			return Typ[TYP_Invalid]
+		}
+
+		return c.expr(node.Params[0][0])
+	case AST_List:
+		return c.listLit(node)
+	}
+
+	if _, ok := binaryKinds[node.Kind]; ok {
+		return c.binary(node)
+	}
+
+	if node.Kind == AST_Not || node.Kind == AST_BNot || node.Kind == AST_Neg {
+		return c.unary(node)
+	}
+
+	err := fmt.Sprintf("Expected expression, found %s", node.Kind)
+	c.report(26, node.Span, err)
+	return Typ[TYP_Invalid]
+}
+
+// binary checks the operands of a binary operator against its class.
+func (c *Checker) binary(node *ASTNode) Type {
+	lhs := c.operand(node.LHS, node.Kind)
+	rhs := c.operand(node.RHS, node.Kind)
+
+	if isInvalid(lhs) || isInvalid(rhs) {
+		return Typ[TYP_Invalid]
+	}
+
+	operands := func(ok func(Type) bool, want string) bool {
+		for _, side := range []*ASTNode{node.LHS, node.RHS} {
+			if typ := c.Info.Types[side]; !ok(typ) {
+				err := fmt.Sprintf("Operator %s needs %s, found `%s`", node.Kind, want, typ)
+				c.report(42, side.Span, err)
+				return false
+			}
+		}
+
+		return true
+	}
+
+	matching := func() bool {
+		lhs, rhs = c.unify(node.LHS, node.RHS)
+		if Identical(lhs, rhs) {
+			return true
+		}
+
+		err := fmt.Sprintf("Mismatched types `%s` and `%s` for %s", lhs, rhs, node.Kind)
+		c.Diags = append(c.Diags, &Diagnostic{
+			Code:    41,
+			Message: err,
+			Span:    node.Span,
+			Labels:  []Label{{node.LHS.Span, lhs.String()}, {node.RHS.Span, rhs.String()}},
+			Notes:   []string{"convert one side with `::`, e.g. `x :: f64`"},
+		})
+		return false
+	}
+
+	switch node.Kind.Class() {
+	case "Math":
+		ok := isNumeric
+		want := "numbers"
+		if node.Kind == AST_Add {
+			ok = func(t Type) bool { return isNumeric(t) || isBasic(t, TYP_String) }
+			want = "numbers or strings"
+		} else if node.Kind == AST_Mod {
+			ok, want = isInteger, "integers"
+		}
+
+		if !operands(ok, want) || !matching() {
+			return Typ[TYP_Invalid]
+		}
+
+		return lhs
+	case "Logic":
+		if !operands(func(t Type) bool { return isBasic(t, TYP_Bool) }, "`bool` values") {
+			return Typ[TYP_Invalid]
+		}
+
+		return Typ[TYP_Bool]
+	case "Bitwise":
+		if !operands(isInteger, "integers") {
+			return Typ[TYP_Invalid]
+		}
+
+		// The shift count doesn't have to be of the shifted type
+		if node.Kind == AST_BLeft || node.Kind == AST_BRight {
+			c.defaultExpr(node.RHS)
+		} else if !matching() {
+			return Typ[TYP_Invalid]
+		}
+
+		return lhs
+	case "Equality":
+		if !matching() {
+			return Typ[TYP_Invalid]
+		}
+
+		if node.Kind != AST_Equal && node.Kind != AST_NotEqual && !isOrdered(lhs) {
+			err := fmt.Sprintf("Operator %s needs ordered values, found `%s`", node.Kind, lhs)
+			c.report(42, node.Span, err)
+			return Typ[TYP_Invalid]
+		}
+
+		return Typ[TYP_Bool]
+	}
+
+	err := fmt.Sprintf("Unknown binary operator %s", node.Kind)
+	c.report(42, node.Span, err)
+	return Typ[TYP_Invalid]
+}
+
+// operand checks an operand of the binary operator op. The operands of `==`
+// and `!=` may be types, to compare with a `::x`, as in `::x == int`.
+func (c *Checker) operand(node *ASTNode, op ASTKind) Type {
+	isType := node.Kind == AST_ListId
+	if node.Kind == AST_Id {
+		sym := c.Scope.Lookup(node.Value)
+		isType = sym != nil && sym.Kind == SYM_Type
+	}
+
+	if !isType || op != AST_Equal && op != AST_NotEqual {
+		return c.expr(node)
+	}
+
+	typ := c.resolveType(node)
+	if isInvalid(typ) {
+		c.Info.Types[node] = typ
+		return typ
+	}
+
+	c.Info.Types[node] = Typ[TYP_Type]
+	c.Info.Values[node] = constant.MakeString(typ.String())
+	return Typ[TYP_Type]
+}
+
+// embedded checks an expression embedded in an interpolated string, which
+// has to convert to a string.
+func (c *Checker) embedded(node *ASTNode) {
+	typ := c.defaultExpr(node)
+
+	switch {
+	case isInvalid(typ):
+	case isBasic(typ, TYP_Void):
+		err := fmt.Sprintf("Expected a value, but %s returns nothing", describe(node))
+		c.report(42, node.Span, err)
+	case ConversionOf(typ, Typ[TYP_String]) == CNV_Invalid:
+		err := fmt.Sprintf("Can't embed `%s` in a string", typ)
+		c.Diags = append(c.Diags, &Diagnostic{
+			Code:    56,
+			Message: err,
+			Span:    node.Span,
+			Notes:   []string{"numbers, runes, bools, strings and types can be embedded"},
+		})
+	}
+}
+
+// cast checks `value :: Type` against ConversionOf, recording the conversion
+// it does.
+func (c *Checker) cast(node *ASTNode) Type {
+	from := c.defaultExpr(node.LHS)
+	to := c.resolveType(node.RHS)
+
+	if isInvalid(from) || isInvalid(to) {
+		return to
+	}
+
+	conv := ConversionOf(from, to)
+	if conv == CNV_Invalid {
+		err := fmt.Sprintf("Can't convert `%s` to `%s`", from, to)
+		diag := &Diagnostic{
+			Code:    56,
+			Message: err,
+			Span:    node.Span,
+			Labels:  []Label{{node.LHS.Span, from.String()}},
+		}
+
+		if isBasic(to, TYP_Bool) && isNumeric(from) {
+			diag.Notes = []string{"compare it instead, e.g. `x != 0`"}
+		}
+
+		c.Diags = append(c.Diags, diag)
+		return Typ[TYP_Invalid]
+	}
+
+	c.Info.Conversions[node] = conv
+	return to
+}
+
+func (c *Checker) unary(node *ASTNode) Type {
+	typ := c.expr(node.LHS)
+	if isInvalid(typ) {
+		return Typ[TYP_Invalid]
+	}
+
+	if node.Kind == AST_Not && !isBasic(typ, TYP_Bool) {
+		err := fmt.Sprintf("Operator %s needs a `bool` value, found `%s`", node.Kind, typ)
+		c.report(42, node.LHS.Span, err)
+		return Typ[TYP_Invalid]
+	}
+
+	if node.Kind == AST_BNot && !isInteger(typ) {
+		err := fmt.Sprintf("Operator %s needs an integer, found `%s`", node.Kind, typ)
+		c.report(42, node.LHS.Span, err)
+		return Typ[TYP_Invalid]
+	}
+
+	if node.Kind == AST_Neg && !isNumeric(typ) {
+		err := fmt.Sprintf("Operator %s needs a number, found `%s`", node.Kind, typ)
+		c.report(42, node.LHS.Span, err)
+		return Typ[TYP_Invalid]
+	}
+
+	return typ
+}
+
+// call checks the arguments of a call against the parameters of the function
+// called, returning its result.
+func (c *Checker) call(node *ASTNode) Type {
+	fnType := c.expr(node.LHS)
+
+	args := []Type{}
+	for _, param := range node.Params {
+		args = append(args, c.expr(param[0]))
+	}
+
+	if isInvalid(fnType) {
+		return Typ[TYP_Invalid]
+	}
+
+	sig, ok := fnType.(*Signature)
+	if !ok {
+		err := fmt.Sprintf("Can't call %s of type `%s`", describe(node.LHS), fnType)
+		c.report(45, node.LHS.Span, err)
+		return Typ[TYP_Invalid]
+	}
+
+	if len(args) != len(sig.Params) {
+		noun := "arguments"
+		if len(sig.Params) == 1 {
+			noun = "argument"
+		}
+
+		err := fmt.Sprintf("Expected %d %s for %s, found %d", len(sig.Params), noun, describe(node.LHS), len(args))
+		diag := &Diagnostic{Code: 43, Message: err, Span: node.Span}
+
+		if sym := c.Info.Uses[node.LHS]; sym != nil && sym.Decl != nil {
+			diag.Labels = []Label{{sym.Decl.Span, "declared here"}}
+		}
+
+		c.Diags = append(c.Diags, diag)
+	} else {
+		for i, arg := range args {
+			if !c.assignable(node.Params[i][0], sig.Params[i]) {
+				err := fmt.Sprintf("Expected `%s` for argument %d, found `%s`", sig.Params[i], i+1, arg)
+				c.report(44, node.Params[i][0].Span, err)
+			}
+		}
+	}
+
+	if sig.Arrow == AST_Bad {
+		return Typ[TYP_Void]
+	}
+
+	return sig.Result
+}
+
+func (c *Checker) index(node *ASTNode) Type {
+	typ := c.expr(node.LHS)
+	c.indexValue(node.RHS)
+
+	switch typ := typ.(type) {
+	case *List:
+		return typ.Elem
+	case *Basic:
+		switch typ.Kind {
+		case TYP_Invalid:
+			return Typ[TYP_Invalid]
+		case TYP_String:
+			return Typ[TYP_Rune]
+		}
+	}
+
+	err := fmt.Sprintf("Can't index %s of type `%s`", describe(node.LHS), typ)
+	c.report(51, node.LHS.Span, err)
+	return Typ[TYP_Invalid]
+}
+
+func (c *Checker) slice(node *ASTNode) Type {
+	typ := c.expr(node.LHS)
+	for _, bound := range node.Params {
+		for _, value := range bound {
+			c.indexValue(value)
+		}
+	}
+
+	switch typ := typ.(type) {
+	case *List:
+		return &List{Len: -1, Elem: typ.Elem}
+	case *Basic:
+		switch typ.Kind {
+		case TYP_Invalid:
+			return Typ[TYP_Invalid]
+		case TYP_String:
+			return Typ[TYP_String]
+		}
+	}
+
+	err := fmt.Sprintf("Can't slice %s of type `%s`", describe(node.LHS), typ)
+	c.report(51, node.LHS.Span, err)
+	return Typ[TYP_Invalid]
+}
+
+func (c *Checker) indexValue(node *ASTNode) {
+	if typ := c.defaultExpr(node); !isInteger(typ) && !isInvalid(typ) {
+		err := fmt.Sprintf("Expected integer index, found `%s`", typ)
+		c.report(51, node.Span, err)
+	}
+}
+
+func (c *Checker) listLit(node *ASTNode) Type {
+	typ := c.resolveType(node.LHS)
+	list, ok := typ.(*List)
+	if !ok {
+		for _, elem := range node.Children {
+			c.expr(elem)
+		}
+
+		return Typ[TYP_Invalid]
+	}
+
+	for _, elem := range node.Children {
+		if typ := c.expr(elem); !c.assignable(elem, list.Elem) {
+			err := fmt.Sprintf("Expected `%s` in list of `%s`, found `%s`", list.Elem, list, typ)
+			c.report(44, elem.Span, err)
+		}
+	}
+
+	if list.Len >= 0 && len(node.Children) > list.Len {
+		err := fmt.Sprintf("Too many values for `%s`: %d", list, len(node.Children))
+		c.report(51, node.Children[list.Len].Span, err)
+	}
+
+	return list
+}
+
+// describe names an expression for messages, e.g. "`count`" for a name.
+func describe(node *ASTNode) string {
+	switch {
+	case node.Kind == AST_Id:
+		return fmt.Sprintf("`%s`", node.Value)
+	case node.Kind == AST_Call && node.LHS.Kind == AST_Id:
+		return fmt.Sprintf("`%s()`", node.LHS.Value)
+	}
+
+	return strings.ToLower(node.Kind.String())
+}
+
+//====== Untyped constants ======//
+
+// Number and char literals without a suffix are untyped constants. They take
+// the type of where they are used, so `x + 1` is a `u8` if `x` is, and fall
+// back to `int`, `rune` or `f64` where nothing decides it, as in `x := 1`.
+// An expression of only untyped constants, such as `1 + 2.5`, is untyped too,
+// of the widest kind among them: int, then rune, then float.
+//
+// An untyped constant has to hold its value exactly in the type it takes:
+//
+//	an integer or rune  becomes any integer type that holds it
+//	                    or any float type that holds it exactly, e.g. not
+//	                    16777217 as an `f32`
+//	a float             becomes any float type it doesn't overflow, or an
+//	                    integer type if it is a whole number, e.g. 2.0
+//
+// Values that are already typed are never promoted beyond Assignable, so an
+// `int` variable only meets a float through `::`.
+
+// defaultExpr checks an expression whose type nothing around it decides,
+// giving an untyped constant its default type.
+func (c *Checker) defaultExpr(node *ASTNode) Type {
+	typ := c.expr(node)
+	if isUntyped(typ) {
+		c.convertUntyped(node, DefaultType(typ))
+	}
+
+	return c.Info.Types[node]
+}
+
+// assignable reports whether the checked expression node can be used as a
+// value of type to, converting it first if it is an untyped constant.
+func (c *Checker) assignable(node *ASTNode, to Type) bool {
+	from := c.Info.Types[node]
+	if isUntyped(from) && !c.convertUntyped(node, to) {
+		return false
+	}
+
+	return Assignable(c.Info.Types[node], to)
+}
+
+// unify converts an untyped operand of a binary operator to the type of the
+// other one, returning the types of both after. Two untyped operands take the
+// widest kind of the two.
+func (c *Checker) unify(lhs, rhs *ASTNode) (Type, Type) {
+	lhsType, rhsType := c.Info.Types[lhs], c.Info.Types[rhs]
+
+	switch {
+	case isUntyped(lhsType) && isUntyped(rhsType):
+		wide := max(lhsType.(*Basic).Kind, rhsType.(*Basic).Kind)
+		c.convertUntyped(lhs, Typ[wide])
+		c.convertUntyped(rhs, Typ[wide])
+	case isUntyped(lhsType):
+		c.convertUntyped(lhs, rhsType)
+	case isUntyped(rhsType):
+		c.convertUntyped(rhs, lhsType)
+	}
+
+	return c.Info.Types[lhs], c.Info.Types[rhs]
+}
+
+// convertUntyped gives the untyped constant node, and the untyped constants
+// it is made of, the type target. It reports whether target can take a
+// constant of its kind, reporting it itself if the value doesn't fit.
+func (c *Checker) convertUntyped(node *ASTNode, target Type) bool {
+	return c.retype(node, target, true)
+}
+
+// retype does convertUntyped, checking the value fits only if check is set.
+// Only the value of a whole constant expression has to fit, so the operands
+// of one whose value is known aren't checked, as with the 128 of `-128` as an
+// `i8`.
+func (c *Checker) retype(node *ASTNode, target Type, check bool) bool {
+	from := c.Info.Types[node]
+	if !isUntyped(from) || isInvalid(target) {
+		return true
+	}
+
+	to, ok := target.(*Basic)
+	if !ok || !isNumeric(to) {
+		return false
+	}
+
+	val := c.Info.Values[node]
+	known := val != nil
+
+	if check {
+		if hasInfo(from, INF_Float) && isInteger(to) && (val == nil || constant.ToInt(val).Kind() != constant.Int) {
+			return false
+		}
+
+		// An untyped target only widens the kind, with no range to check
+		if val != nil && !isUntyped(to) {
+			if err := representable(val, to); err != "" {
+				c.report(36, node.Span, err)
+				val = nil
+				delete(c.Info.Values, node)
+			}
+		}
+	}
+
+	c.Info.Types[node] = to
+
+	switch {
+	case val == nil:
+	case isInteger(to) && constant.ToInt(val).Kind() == constant.Int:
+		c.Info.Values[node] = constant.ToInt(val)
+	case isInteger(to):
+		// A part of a whole number, e.g. the 0.5 of `0.5 + 0.5`
+		delete(c.Info.Values, node)
+	default:
+		c.Info.Values[node] = constant.ToFloat(val)
+	}
+
+	check = check && !known
+
+	switch {
+	case node.Kind == AST_Group && len(node.Params) == 1:
+		c.retype(node.Params[0][0], to, check)
+	case node.Kind == AST_BNot || node.Kind == AST_Neg:
+		c.retype(node.LHS, to, check)
+	case node.Kind == AST_BLeft || node.Kind == AST_BRight:
+		c.retype(node.LHS, to, check)
+	case node.Kind.Class() == "Math" || node.Kind.Class() == "Bitwise":
+		c.retype(node.LHS, to, check)
+		c.retype(node.RHS, to, check)
+	}
+
+	return true
+}
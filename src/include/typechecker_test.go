@@ -0,0 +1,169 @@
+package include
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// checkSrc parses and checks src, failing the test on a parse error.
+func checkSrc(t *testing.T, src string) (*File, *Info, []*Diagnostic) {
+	t.Helper()
+
+	file := ParseString("test.wp", src, nil)
+	if len(file.Diags) > 0 {
+		t.Fatalf("parsing %q: %s", src, file.Diags[0].Message)
+	}
+
+	info, diags := Check(file)
+	return file, info, diags
+}
+
+func TestCheckDiagnostics(t *testing.T) {
+	tests := []struct {
+		src  string
+		code int
+		msg  string
+	}{
+		{"x := y", 40, "Undefined name `y`"},
+		{"x := 1\ny := x + 2.5", 41, "Mismatched types `int` and `untyped float` for Add"},
+		{"x := !1", 42, "Operator Not needs a `bool` value, found `untyped int`"},
+		{"fn f(a int) {\n}\nf()", 43, "Expected 1 argument for `f`, found 0"},
+		{"fn f(a int) {\n}\nf(\"a\")", 44, "Expected `int` for argument 1, found `string`"},
+		{"x := 1\nx()", 45, "Can't call `x` of type `int`"},
+		{"x := 1\nx := 2", 46, "`x` is already declared in this scope"},
+		{"fn f() -> int {\n\treturn \"a\"\n}", 47, "Can't return `string` from a function returning `int`"},
+		{"if 1 {\n}", 48, "Expected `bool` condition, found `untyped int`"},
+		{"x := 1\nx = \"a\"", 49, "Can't assign `string` to `x` of type `int`"},
+		{"fn f(a foo) {\n}", 50, "Unknown type `foo`"},
+		{"x := 1\ny := x[0]", 51, "Can't index `x` of type `int`"},
+		{"x := 1\ny := x.len", 52, "`int` has no member `len`"},
+		{"x := (1, 2)", 53, "Expected a single value in parentheses, found 2"},
+		{"x := nil", 54, "Can't infer the type of `x` from `nil`"},
+		{"x := 1\nc #= x", 55, "Value of constant `c` isn't known at compile time"},
+		{"x := \"1\" :: int", 56, "Can't convert `string` to `int`"},
+		{"l := []int{}\ns := \"{l}\"", 56, "Can't embed `[]int` in a string"},
+		{"fn f() {\n}\ns := \"{f()}\"", 42, "Expected a value, but `f()` returns nothing"},
+		{"fn f(b u8) {\n}\nf(256)", 36, "Constant 256 overflows `u8`"},
+		{"x := 16777217 :: f64\nfn f(a f32) {\n}\nf(16777217)", 36, "Constant 16777217 can't be held exactly by `f32`"},
+		{"x := 9999999999999999999 + 1", 36, "Constant 10000000000000000000 overflows `int`"},
+	}
+
+	for _, test := range tests {
+		_, _, diags := checkSrc(t, test.src)
+		if len(diags) != 1 {
+			t.Errorf("Check(%q): got %d diagnostics, want 1: %v", test.src, len(diags), diags)
+			continue
+		}
+
+		if diags[0].Code != test.code || diags[0].Message != test.msg {
+			t.Errorf("Check(%q):\n got E%03d %s\nwant E%03d %s", test.src, diags[0].Code, diags[0].Message, test.code, test.msg)
+		}
+	}
+}
+
+func TestCheckInference(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"x := 1", "int"},
+		{"x := 1.5", "f64"},
+		{"x := 'a'", "rune"},
+		{"x := 1 + 2.5", "f64"},
+		{"x := 'a' + 1", "rune"},
+		{"x := 1 + 2u16", "u16"},
+		{"x := (1 + 2) * 2u16", "u16"},
+		{"x := -128i8", "i8"},
+		{"x := 1 == 2.0", "bool"},
+		{"x := [2]int{1, 2}", "[2]int"},
+		{"x := ::1", "type"},
+		{"c #= 4\nx := [c]u8{}", "[4]u8"},
+	}
+
+	for _, test := range tests {
+		file, info, diags := checkSrc(t, test.src)
+		if len(diags) > 0 {
+			t.Errorf("Check(%q): unexpected %s", test.src, diags[0].Message)
+			continue
+		}
+
+		decl := file.Root.Children[len(file.Root.Children)-1]
+		if got := info.Defs[decl.LHS].Type.String(); got != test.want {
+			t.Errorf("Check(%q): x is `%s`, want `%s`", test.src, got, test.want)
+		}
+	}
+}
+
+func TestCheckConstantChange(t *testing.T) {
+	for _, stmt := range []string{"c = 2", "c++", "c--"} {
+		_, _, diags := checkSrc(t, "c #= 1\n"+stmt)
+		if len(diags) != 1 || diags[0].Code != 49 || diags[0].Message != "Can't change constant `c`" {
+			t.Errorf("Check(%q): got %v, want E049 for the constant", stmt, diags)
+		}
+	}
+}
+
+// defs lists the names declared in info with their types, in source order.
+func defs(info *Info) string {
+	syms := slices.Collect(maps.Values(info.Defs))
+	slices.SortFunc(syms, func(a, b *Symbol) int {
+		return a.Decl.Span.Start.Offset - b.Decl.Span.Start.Offset
+	})
+
+	out := []string{}
+	for _, sym := range syms {
+		out = append(out, sym.Name+" "+sym.Type.String())
+	}
+
+	return strings.Join(out, ", ")
+}
+
+// codes lists the codes of diags.
+func codes(diags []*Diagnostic) []int {
+	out := []int{}
+	for _, diag := range diags {
+		out = append(out, diag.Code)
+	}
+
+	return out
+}
+
+// TestCheckPartial checks files that failed to parse: what parsed is still
+// checked and typed, and what didn't is left out.
+func TestCheckPartial(t *testing.T) {
+	tests := []struct {
+		src   string
+		parse []int
+		check []int
+		defs  string
+	}{
+		{"x := 3 @ 4\ny := 5", []int{22}, []int{}, "y int"},
+		{"fn g() { a := ; b := 2 }\nz := g", []int{26}, []int{}, "g fn(), b int, z fn()"},
+		{"fn f(a int) -> int {\n\treturn a +\n}\nv := f(1)", []int{26}, []int{}, "f fn(int) -> int, a int, v int"},
+		{"x := (1 +\ny := 2\nw := y", []int{28, 28}, []int{40}, "x invalid type"},
+		{"[\nz := 1", []int{28}, []int{}, ""},
+		{"fn f(a int) {\n}\nfn g() {\n\tf(1\n}\nx := y", []int{28}, []int{40}, "f fn(int), a int, g fn(), x invalid type"},
+		{"fn g() {\n\th(1 @ 2\n\tb := 1\n}\nz := 2", []int{22, 28}, []int{40}, "g fn(), z int"},
+		{"fn h(a int, b\n}\nz := 1", []int{28, 28, 28}, []int{}, "z int"},
+		{"fn add(a int, bint) -> int {\n\treturn a\n}\nx := add(1, 2)", []int{28}, []int{}, "add fn(int, invalid type) -> int, a int, x int"},
+	}
+
+	for _, test := range tests {
+		file := ParseString("test.wp", test.src, nil)
+		info, diags := Check(file)
+
+		if got := codes(file.Diags); !slices.Equal(got, test.parse) {
+			t.Errorf("Parse(%q): got codes %v, want %v", test.src, got, test.parse)
+		}
+
+		if got := codes(diags); !slices.Equal(got, test.check) {
+			t.Errorf("Check(%q): got codes %v, want %v", test.src, got, test.check)
+		}
+
+		if got := defs(info); got != test.defs {
+			t.Errorf("Check(%q): declared %q, want %q", test.src, got, test.defs)
+		}
+	}
+}
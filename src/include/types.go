@@ -1,18 +1,143 @@
 package include
 
-import "bufio"
+import (
+	"fmt"
+	"io"
+)
+
+// File is a parsed source file: its tree, its comments in source order, and
+// the diagnostics found on the way, sorted by position.
+type File struct {
+	Name     string
+	Src      string
+	Root     *ASTNode
+	Comments []Comment
+	Diags    []*Diagnostic
+}
+
+// Options tune parsing. The zero value reports every error and traces
+// nothing.
+type Options struct {
+	// MaxErrors stops parsing once this many diagnostics are found, if set.
+	MaxErrors int
+	// Trace, if set, is written a line for each statement parsed.
+	Trace io.Writer
+}
 
 type Parser struct {
-	LineNum int
-	LineCol int
+	File    string
 	Context ASTKind
+	Fn      *ASTNode
+	Trace   io.Writer
+
+	Tokens   []Token
+	Comments []Comment
+	Cursor   int
+	Diags    []*Diagnostic
+}
+
+type Lexer struct {
+	File     string
+	Src      string
+	Pos      Position
+	Tokens   []Token
+	Comments []Comment
+	Nesting  []TokenKind
+	Diags    []*Diagnostic
+}
+
+type Position struct {
+	Line   int `json:"line"`
+	Col    int `json:"col"`
+	Offset int `json:"offset"`
+}
+
+// Span covers the source of a token or node, from Start up to but not
+// including End.
+type Span struct {
+	File  string   `json:"file,omitempty"`
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type Token struct {
+	Kind   TokenKind
+	Value  string
+	Raw    string
+	Suffix string
+	Parts  []StringPart
+	Pos    Position
+	End    Position
+}
+
+// Comment is a comment the lexer skipped, kept so that tools such as a
+// formatter can put it back. Text is the source of the comment, markers
+// included. Comments inside a string's embedded expressions are part of the
+// string and aren't kept.
+type Comment struct {
+	Kind CommentKind
+	Text string
+	Span Span
+}
+
+type CommentKind int
+
+const (
+	COM_Line  CommentKind = iota // // ...
+	COM_Block                    // /* ... */, possibly nested
+	COM_Doc                      // /// ..., documenting the next declaration
+)
+
+// StringPart is a piece of an interpolated string, either literal Text or the
+// tokens of an embedded `{...}` expression in Expr, ending with TOK_EOF.
+type StringPart struct {
+	Text string
+	Expr []Token
+}
+
+// Diagnostic is an error, warning or note reported about the source. Its
+// Code is stable and doubles as the exit code of the compiler.
+type Diagnostic struct {
+	Severity Severity
+	Code     int
+	Message  string
+	Span     Span
+
+	Labels []Label
+	Notes  []string
+	Fixes  []Fix
+}
+
+// Label marks a secondary span of a diagnostic, e.g. where a block was opened.
+type Label struct {
+	Span    Span
+	Message string
+}
+
+// Fix suggests replacing the code under Span with Replacement. An empty span
+// inserts, an empty replacement removes.
+type Fix struct {
+	Span        Span
+	Replacement string
+	Message     string
+}
+
+type Severity int
 
-	Scanner bufio.Scanner
+const (
+	SEV_Error Severity = iota
+	SEV_Warning
+	SEV_Note
+)
+
+var sevName = map[Severity]string{
+	SEV_Error:   "error",
+	SEV_Warning: "warning",
+	SEV_Note:    "note",
 }
 
-type Error struct {
-	Info     string
-	ExitCode int
+func (sev Severity) String() string {
+	return sevName[sev]
 }
 
 type ASTNode struct {
@@ -24,6 +149,15 @@ type ASTNode struct {
 	Children []*ASTNode
 	Params   [][]*ASTNode
 	Value    string
+	Raw      string
+	Doc      string
+	Span     Span
+
+	// Numeric literals are decoded into Int, or Float for floats. Suffix is
+	// the literal's width suffix, e.g. `u8` for `42u8`.
+	Int    uint64
+	Float  float64
+	Suffix string
 }
 
 type ASTKind int
@@ -73,16 +207,21 @@ const (
 	AST_Dec    // LHS--
 	AST_TypeOf // ::LHS
 	AST_BNot   // .!LHS
+	AST_Neg    // -LHS
 
 	//====== Values ======//
-	AST_Int    // 32
-	AST_Float  // 32.45
-	AST_Binary // 0b101
-	AST_Hex    // 0xF3
-	AST_String // "..."
-	AST_List   // [...]Id{...}
-	AST_Id     // name
-	AST_ListId // [...]Id
+	AST_Int       // 32
+	AST_Float     // 32.45
+	AST_Binary    // 0b101
+	AST_Octal     // 0o755
+	AST_Hex       // 0xF3
+	AST_String    // "..."
+	AST_Char      // 'c'
+	AST_Interp    // "...{x}...", pieces and expressions in Children
+	AST_List      // LHS{...}, with an AST_ListId in LHS
+	AST_Id        // name
+	AST_ListId    // [LHS]RHS, or []RHS for dynamic lists
+	AST_TypeValue // a type as a value, named by Value, e.g. an inlined `::x`
 
 	//====== Conditionals ======//
 	AST_If    // if LHS RHS ALT
@@ -110,10 +249,14 @@ const (
 	AST_Function // fn Id(Id T) RHS
 	AST_Block    // {...}
 	AST_Group    // (...)
-	AST_Call     // f(x)
+	AST_Call     // LHS(x, y)
+	AST_Member   // LHS.Id
+	AST_Index    // LHS[RHS]
+	AST_Slice    // LHS[lo:hi]
+	AST_Bad      // source that failed to parse
 )
 
-var AST_Num = []ASTKind{AST_Int, AST_Float, AST_Hex, AST_Binary}
+var AST_Num = []ASTKind{AST_Int, AST_Float, AST_Hex, AST_Octal, AST_Binary}
 var AST_Math = []ASTKind{AST_Add, AST_Sub, AST_Mul, AST_Div, AST_Pow, AST_Mod}
 var AST_Bitwise = []ASTKind{AST_BAnd, AST_BOr, AST_BXor, AST_BNot}
 var AST_Bool = []ASTKind{AST_True, AST_False}
@@ -159,16 +302,21 @@ var astName = map[ASTKind]string{
 	AST_Dec:    "Decrement",
 	AST_TypeOf: "Type Of",
 	AST_BNot:   "Bitwise Not",
+	AST_Neg:    "Negate",
 
 	//====== Values ======//
-	AST_Int:    "Integer",
-	AST_Float:  "Float",
-	AST_Binary: "Binary",
-	AST_Hex:    "Hexadecimal",
-	AST_String: "String",
-	AST_List:   "List",
-	AST_Id:     "Identifier",
-	AST_ListId: "List-type Identifier",
+	AST_Int:       "Integer",
+	AST_Float:     "Float",
+	AST_Binary:    "Binary",
+	AST_Octal:     "Octal",
+	AST_Hex:       "Hexadecimal",
+	AST_String:    "String",
+	AST_Char:      "Character",
+	AST_Interp:    "Interpolated String",
+	AST_List:      "List",
+	AST_Id:        "Identifier",
+	AST_ListId:    "List-type Identifier",
+	AST_TypeValue: "Type Value",
 
 	//====== Conditionals ======//
 	AST_If:    "If Statement",
@@ -197,6 +345,10 @@ var astName = map[ASTKind]string{
 	AST_Block:    "Block",
 	AST_Group:    "Group",
 	AST_Call:     "Function Call",
+	AST_Member:   "Member Access",
+	AST_Index:    "Index",
+	AST_Slice:    "Slice",
+	AST_Bad:      "Error",
 }
 
 func (astType ASTKind) String() string {
@@ -205,7 +357,7 @@ func (astType ASTKind) String() string {
 
 func (astType ASTKind) Class() string {
 	switch astType {
-	case AST_Add, AST_Sub, AST_Div, AST_Mul, AST_Pow, AST_Mod, AST_Inc, AST_Dec:
+	case AST_Add, AST_Sub, AST_Div, AST_Mul, AST_Pow, AST_Mod, AST_Inc, AST_Dec, AST_Neg:
 		return "Math"
 	case AST_And, AST_Or, AST_Not:
 		return "Logic"
@@ -225,3 +377,186 @@ func (astType ASTKind) Class() string {
 		return "Other"
 	}
 }
+
+type TokenKind int
+
+const (
+	//=====================//
+	//     Token Kinds     //
+	//=====================//
+
+	TOK_EOF     TokenKind = iota
+	TOK_Newline           // \n ending a statement
+	TOK_Bad               // source that failed to lex
+
+	//====== Words ======//
+	TOK_Id      // name
+	TOK_Keyword // fn, if, return, ...
+
+	//====== Literals ======//
+	TOK_Int    // 32
+	TOK_Float  // 32.45
+	TOK_Binary // 0b101
+	TOK_Octal  // 0o755
+	TOK_Hex    // 0xF3
+	TOK_String // "..."
+	TOK_Char   // 'c'
+
+	//====== Maths ======//
+	TOK_Add // +
+	TOK_Sub // -
+	TOK_Div // /
+	TOK_Mul // *
+	TOK_Pow // ^
+	TOK_Mod // %
+	TOK_Inc // ++
+	TOK_Dec // --
+
+	//====== Logic ======//
+	TOK_And // &
+	TOK_Or  // |
+	TOK_Not // !
+
+	//====== Bitwise ======//
+	TOK_BAnd   // .&
+	TOK_BOr    // .|
+	TOK_BXor   // .^
+	TOK_BLeft  // .<
+	TOK_BRight // .>
+	TOK_BNot   // .!
+
+	//====== Equality ======//
+	TOK_Equal          // ==
+	TOK_NotEqual       // !=
+	TOK_Greater        // >
+	TOK_Lesser         // <
+	TOK_GreaterOrEqual // >=
+	TOK_LesserOrEqual  // <=
+
+	//====== Assignment ======//
+	TOK_Variable // :=
+	TOK_Constant // #=
+	TOK_TypeOp   // ::
+	TOK_Assign   // =
+
+	//====== Exits ======//
+	TOK_ExitCode // <-
+	TOK_ExitNow  // <!
+
+	//====== Returns ======//
+	TOK_ReturnOnly   // ->
+	TOK_ReturnNil    // ~>
+	TOK_ReturnErr    // !>
+	TOK_ReturnErrNil // ?>
+
+	//====== Delimiters ======//
+	TOK_LParen // (
+	TOK_RParen // )
+	TOK_LBrace // {
+	TOK_RBrace // }
+	TOK_LBrack // [
+	TOK_RBrack // ]
+	TOK_Colon  // :
+	TOK_Comma  // ,
+	TOK_Semi   // ;
+	TOK_Dot    // .
+)
+
+var tokName = map[TokenKind]string{
+	TOK_EOF:     "EOF",
+	TOK_Newline: "Newline",
+	TOK_Bad:     "Error",
+
+	//====== Words ======//
+	TOK_Id:      "Identifier",
+	TOK_Keyword: "Keyword",
+
+	//====== Literals ======//
+	TOK_Int:    "Integer",
+	TOK_Float:  "Float",
+	TOK_Binary: "Binary",
+	TOK_Octal:  "Octal",
+	TOK_Hex:    "Hexadecimal",
+	TOK_String: "String",
+	TOK_Char:   "Character",
+
+	//====== Maths ======//
+	TOK_Add: "`+`",
+	TOK_Sub: "`-`",
+	TOK_Div: "`/`",
+	TOK_Mul: "`*`",
+	TOK_Pow: "`^`",
+	TOK_Mod: "`%`",
+	TOK_Inc: "`++`",
+	TOK_Dec: "`--`",
+
+	//====== Logic ======//
+	TOK_And: "`&`",
+	TOK_Or:  "`|`",
+	TOK_Not: "`!`",
+
+	//====== Bitwise ======//
+	TOK_BAnd:   "`.&`",
+	TOK_BOr:    "`.|`",
+	TOK_BXor:   "`.^`",
+	TOK_BLeft:  "`.<`",
+	TOK_BRight: "`.>`",
+	TOK_BNot:   "`.!`",
+
+	//====== Equality ======//
+	TOK_Equal:          "`==`",
+	TOK_NotEqual:       "`!=`",
+	TOK_Greater:        "`>`",
+	TOK_Lesser:         "`<`",
+	TOK_GreaterOrEqual: "`>=`",
+	TOK_LesserOrEqual:  "`<=`",
+
+	//====== Assignment ======//
+	TOK_Variable: "`:=`",
+	TOK_Constant: "`#=`",
+	TOK_TypeOp:   "`::`",
+	TOK_Assign:   "`=`",
+
+	//====== Exits ======//
+	TOK_ExitCode: "`<-`",
+	TOK_ExitNow:  "`<!`",
+
+	//====== Returns ======//
+	TOK_ReturnOnly:   "`->`",
+	TOK_ReturnNil:    "`~>`",
+	TOK_ReturnErr:    "`!>`",
+	TOK_ReturnErrNil: "`?>`",
+
+	//====== Delimiters ======//
+	TOK_LParen: "`(`",
+	TOK_RParen: "`)`",
+	TOK_LBrace: "`{`",
+	TOK_RBrace: "`}`",
+	TOK_LBrack: "`[`",
+	TOK_RBrack: "`]`",
+	TOK_Colon:  "`:`",
+	TOK_Comma:  "`,`",
+	TOK_Semi:   "`;`",
+	TOK_Dot:    "`.`",
+}
+
+func (tokType TokenKind) String() string {
+	return tokName[tokType]
+}
+
+func (pos Position) String() string {
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Col)
+}
+
+func (span Span) String() string {
+	if span.File == "" {
+		return span.Start.String()
+	}
+
+	// Spans without a position, e.g. of a file that couldn't be read
+	if span.Start.Line == 0 {
+		return span.File
+	}
+
+	return fmt.Sprintf("%s:%s", span.File, span.Start)
+}
@@ -0,0 +1,431 @@
+package include
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Type is the type of a value: a *Basic, a *List or a *Signature.
+type Type interface {
+	String() string
+}
+
+type BasicKind int
+
+const (
+	TYP_Invalid BasicKind = iota // the type of an expression with errors
+	TYP_Void                     // the result of a function without a return type
+	TYP_Nil                      // nil
+
+	TYP_Bool // bool
+
+	// Signed integers
+	TYP_I8  // i8
+	TYP_I16 // i16
+	TYP_I32 // i32
+	TYP_I64 // i64
+	TYP_Int // int, 64 bits
+
+	// Unsigned integers
+	TYP_U8  // u8
+	TYP_U16 // u16
+	TYP_U32 // u32
+	TYP_U64 // u64
+
+	// Floats
+	TYP_F32 // f32
+	TYP_F64 // f64
+
+	TYP_String // string, a pointer and a length
+	TYP_Rune   // rune, a 32 bit code point
+	TYP_Type   // the value of `::x`
+
+	// Constants without a type of their own yet, see Checker.convertUntyped
+	TYP_UntypedInt   // 1, 0xFF
+	TYP_UntypedRune  // 'a'
+	TYP_UntypedFloat // 1.5
+)
+
+type BasicInfo int
+
+const (
+	INF_Integer BasicInfo = 1 << iota
+	INF_Unsigned
+	INF_Float
+	INF_String
+	INF_Untyped
+
+	INF_Numeric = INF_Integer | INF_Float
+	INF_Ordered = INF_Numeric | INF_String
+)
+
+// Basic is a built-in type other than a list or function. Size and Align are
+// in bytes.
+type Basic struct {
+	Kind  BasicKind
+	Name  string
+	Info  BasicInfo
+	Size  int
+	Align int
+}
+
+// List is `[Len]Elem`, or `[]Elem` with a Len of -1.
+type List struct {
+	Len  int
+	Elem Type
+}
+
+// Signature is the type of a function. Arrow is the kind of its return arrow,
+// or AST_Bad if it returns nothing, and Err the optional second type after it.
+type Signature struct {
+	Params []Type
+	Arrow  ASTKind
+	Result Type
+	Err    Type
+}
+
+// Typ holds the built-in types by kind.
+var Typ = []*Basic{
+	TYP_Invalid: {TYP_Invalid, "invalid type", 0, 0, 1},
+	TYP_Void:    {TYP_Void, "void", 0, 0, 1},
+	TYP_Nil:     {TYP_Nil, "nil", 0, 8, 8},
+
+	TYP_Bool: {TYP_Bool, "bool", 0, 1, 1},
+
+	TYP_I8:  {TYP_I8, "i8", INF_Integer, 1, 1},
+	TYP_I16: {TYP_I16, "i16", INF_Integer, 2, 2},
+	TYP_I32: {TYP_I32, "i32", INF_Integer, 4, 4},
+	TYP_I64: {TYP_I64, "i64", INF_Integer, 8, 8},
+	TYP_Int: {TYP_Int, "int", INF_Integer, 8, 8},
+
+	TYP_U8:  {TYP_U8, "u8", INF_Integer | INF_Unsigned, 1, 1},
+	TYP_U16: {TYP_U16, "u16", INF_Integer | INF_Unsigned, 2, 2},
+	TYP_U32: {TYP_U32, "u32", INF_Integer | INF_Unsigned, 4, 4},
+	TYP_U64: {TYP_U64, "u64", INF_Integer | INF_Unsigned, 8, 8},
+
+	TYP_F32: {TYP_F32, "f32", INF_Float, 4, 4},
+	TYP_F64: {TYP_F64, "f64", INF_Float, 8, 8},
+
+	TYP_String: {TYP_String, "string", INF_String, 16, 8},
+	TYP_Rune:   {TYP_Rune, "rune", INF_Integer, 4, 4},
+	TYP_Type:   {TYP_Type, "type", 0, 8, 8},
+
+	TYP_UntypedInt:   {TYP_UntypedInt, "untyped int", INF_Integer | INF_Untyped, 0, 1},
+	TYP_UntypedRune:  {TYP_UntypedRune, "untyped rune", INF_Integer | INF_Untyped, 0, 1},
+	TYP_UntypedFloat: {TYP_UntypedFloat, "untyped float", INF_Float | INF_Untyped, 0, 1},
+}
+
+// Universe is the scope of the built-in names that every file sees.
+var Universe = func() *Scope {
+	scope := NewScope(nil)
+	for _, typ := range Typ[TYP_Bool:TYP_Type] {
+		scope.Symbols[typ.Name] = &Symbol{Name: typ.Name, Kind: SYM_Type, Type: typ}
+	}
+
+	return scope
+}()
+
+// literalTypes are the types of literals without a suffix. Numbers and chars
+// are untyped, taking the type of where they are used.
+var literalTypes = map[ASTKind]*Basic{
+	AST_Int:       Typ[TYP_UntypedInt],
+	AST_Hex:       Typ[TYP_UntypedInt],
+	AST_Octal:     Typ[TYP_UntypedInt],
+	AST_Binary:    Typ[TYP_UntypedInt],
+	AST_Float:     Typ[TYP_UntypedFloat],
+	AST_String:    Typ[TYP_String],
+	AST_Interp:    Typ[TYP_String],
+	AST_Char:      Typ[TYP_UntypedRune],
+	AST_True:      Typ[TYP_Bool],
+	AST_False:     Typ[TYP_Bool],
+	AST_Nil:       Typ[TYP_Nil],
+	AST_TypeValue: Typ[TYP_Type],
+}
+
+// LiteralType returns the type of a literal of the given kind, or of the
+// type its suffix names, e.g. `u8` for `42u8`.
+func LiteralType(kind ASTKind, suffix string) Type {
+	if sym := Universe.Lookup(suffix); sym != nil && sym.Kind == SYM_Type {
+		return sym.Type
+	}
+
+	if typ, ok := literalTypes[kind]; ok {
+		return typ
+	}
+
+	return Typ[TYP_Invalid]
+}
+
+// DefaultType returns the type an untyped constant gets where nothing else
+// decides it, e.g. in `x := 1`: int, rune or f64. Other types are returned
+// as they are.
+func DefaultType(t Type) Type {
+	switch {
+	case isBasic(t, TYP_UntypedInt):
+		return Typ[TYP_Int]
+	case isBasic(t, TYP_UntypedRune):
+		return Typ[TYP_Rune]
+	case isBasic(t, TYP_UntypedFloat):
+		return Typ[TYP_F64]
+	}
+
+	return t
+}
+
+//====== Layout ======//
+
+// SizeOf returns the size of a value of type t in bytes. A dynamic list is a
+// pointer, a length and a capacity, and a function a pointer.
+func SizeOf(t Type) int {
+	switch t := t.(type) {
+	case *Basic:
+		return t.Size
+	case *List:
+		if t.Len < 0 {
+			return 24
+		}
+
+		elem := SizeOf(t.Elem)
+		align := AlignOf(t.Elem)
+		return t.Len * ((elem + align - 1) / align * align)
+	}
+
+	return 8
+}
+
+// AlignOf returns the alignment of a value of type t in bytes.
+func AlignOf(t Type) int {
+	switch t := t.(type) {
+	case *Basic:
+		return t.Align
+	case *List:
+		if t.Len >= 0 {
+			return AlignOf(t.Elem)
+		}
+	}
+
+	return 8
+}
+
+//====== Conversions ======//
+
+// mantissa is the number of bits each float type holds exactly.
+var mantissa = map[BasicKind]int{TYP_F32: 24, TYP_F64: 53}
+
+// Assignable reports whether a value of type from can be used as type to
+// without a conversion. Besides identical types that is:
+//
+//	nil                to a dynamic list
+//	a signed integer   to a signed integer at least as big
+//	an unsigned one    to an unsigned one at least as big, or a bigger signed one
+//	an integer         to a float that holds all its values, e.g. i16 to f32
+//	f32                to f64
+//
+// The rune type only takes runes. Types with errors are assignable to
+// anything, so that one mistake isn't reported over and over.
+func Assignable(from, to Type) bool {
+	if isInvalid(from) || isInvalid(to) || Identical(from, to) {
+		return true
+	}
+
+	// Untyped constants are converted before, where their value is known
+	from = DefaultType(from)
+
+	if list, ok := to.(*List); ok {
+		return isBasic(from, TYP_Nil) && list.Len < 0
+	}
+
+	src, ok := from.(*Basic)
+	dst, ok2 := to.(*Basic)
+	if !ok || !ok2 || src.Kind == TYP_Rune || dst.Kind == TYP_Rune {
+		return false
+	}
+
+	switch {
+	case src.Info&INF_Integer != 0 && dst.Info&INF_Integer != 0:
+		srcSigned := src.Info&INF_Unsigned == 0
+		dstSigned := dst.Info&INF_Unsigned == 0
+
+		if srcSigned == dstSigned {
+			return dst.Size >= src.Size
+		}
+
+		return dstSigned && dst.Size > src.Size
+	case src.Info&INF_Integer != 0 && dst.Info&INF_Float != 0:
+		bits := src.Size * 8
+		if src.Info&INF_Unsigned == 0 {
+			bits--
+		}
+
+		return bits <= mantissa[dst.Kind]
+	case src.Kind == TYP_F32 && dst.Kind == TYP_F64:
+		return true
+	}
+
+	return false
+}
+
+type Conversion int
+
+// The conversions `value :: Type` can do. Narrowing an integer keeps the low
+// bits, while a float out of the range of the integer it is converted to is
+// an error at run time. A constant is checked instead: it has to fit, so
+// `300 :: u8` doesn't compile.
+const (
+	CNV_Invalid    Conversion = iota // not convertible
+	CNV_None                         // identical types, or nil to a list
+	CNV_Extend                       // to a wider integer, sign extending a signed source
+	CNV_Truncate                     // to an integer no wider, keeping the low bits
+	CNV_IntToFloat                   // to the nearest float
+	CNV_FloatToInt                   // toward zero, checked at run time
+	CNV_Float                        // f32 to f64, or f64 to the nearest f32
+	CNV_Format                       // a number, rune, bool or type to a string, as printed
+	CNV_Encode                       // a string to `[]u8` of UTF-8 or `[]rune` of code points
+	CNV_Decode                       // a list of u8 or runes to a string
+)
+
+// ConversionOf returns the conversion `::` does from type from to type to:
+//
+//	from \ to      integer             float         string   list
+//	integer        Extend or Truncate  IntToFloat    Format
+//	float          FloatToInt          Float         Format
+//	bool, type                                       Format
+//	string                                                    Encode to []u8 or []rune
+//	list of u8/rune                                  Decode
+//
+// The rune type is an integer here, and formats as the character it is.
+// Identical types and nil to a dynamic list need no conversion.
+func ConversionOf(from, to Type) Conversion {
+	if Identical(from, to) {
+		return CNV_None
+	}
+
+	if list, ok := to.(*List); ok && isBasic(from, TYP_Nil) && list.Len < 0 {
+		return CNV_None
+	}
+
+	switch {
+	case isInteger(from) && isInteger(to):
+		if SizeOf(to) > SizeOf(from) {
+			return CNV_Extend
+		}
+
+		return CNV_Truncate
+	case isInteger(from) && isNumeric(to):
+		return CNV_IntToFloat
+	case isNumeric(from) && isInteger(to):
+		return CNV_FloatToInt
+	case isNumeric(from) && isNumeric(to):
+		return CNV_Float
+	case isBasic(to, TYP_String):
+		if list, ok := from.(*List); ok && isBasic(list.Elem, TYP_U8, TYP_Rune) {
+			return CNV_Decode
+		}
+
+		if isNumeric(from) || isBasic(from, TYP_Bool, TYP_Type) {
+			return CNV_Format
+		}
+	case isBasic(from, TYP_String):
+		if list, ok := to.(*List); ok && list.Len < 0 && isBasic(list.Elem, TYP_U8, TYP_Rune) {
+			return CNV_Encode
+		}
+	}
+
+	return CNV_Invalid
+}
+
+// Convertible reports whether a value of type from can be converted to type
+// to with `::`, see ConversionOf.
+func Convertible(from, to Type) bool {
+	return ConversionOf(from, to) != CNV_Invalid
+}
+
+//====== Type methods ======//
+
+func (t *Basic) String() string {
+	return t.Name
+}
+
+func (t *List) String() string {
+	if t.Len < 0 {
+		return "[]" + t.Elem.String()
+	}
+
+	return fmt.Sprintf("[%d]%s", t.Len, t.Elem)
+}
+
+func (t *Signature) String() string {
+	params := []string{}
+	for _, param := range t.Params {
+		params = append(params, param.String())
+	}
+
+	out := fmt.Sprintf("fn(%s)", strings.Join(params, ", "))
+	if t.Arrow != AST_Bad {
+		out += " " + arrowName[t.Arrow] + " " + t.Result.String()
+		if t.Err != nil {
+			out += ", " + t.Err.String()
+		}
+	}
+
+	return out
+}
+
+var arrowName = map[ASTKind]string{
+	AST_ReturnOnly:   "->",
+	AST_ReturnNil:    "~>",
+	AST_ReturnErr:    "!>",
+	AST_ReturnErrNil: "?>",
+}
+
+// Identical reports whether a and b are the same type.
+func Identical(a, b Type) bool {
+	switch a := a.(type) {
+	case *Basic:
+		b, ok := b.(*Basic)
+		return ok && a.Kind == b.Kind
+	case *List:
+		b, ok := b.(*List)
+		return ok && a.Len == b.Len && Identical(a.Elem, b.Elem)
+	case *Signature:
+		b, ok := b.(*Signature)
+		if !ok || len(a.Params) != len(b.Params) || a.Arrow != b.Arrow {
+			return false
+		}
+
+		for i := range a.Params {
+			if !Identical(a.Params[i], b.Params[i]) {
+				return false
+			}
+		}
+
+		return identicalOrNil(a.Result, b.Result) && identicalOrNil(a.Err, b.Err)
+	}
+
+	return false
+}
+
+func identicalOrNil(a, b Type) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return Identical(a, b)
+}
+
+func isBasic(t Type, kinds ...BasicKind) bool {
+	basic, ok := t.(*Basic)
+	return ok && slices.Contains(kinds, basic.Kind)
+}
+
+func hasInfo(t Type, info BasicInfo) bool {
+	basic, ok := t.(*Basic)
+	return ok && basic.Info&info != 0
+}
+
+func isInvalid(t Type) bool { return isBasic(t, TYP_Invalid) }
+func isUntyped(t Type) bool { return hasInfo(t, INF_Untyped) }
+func isInteger(t Type) bool { return hasInfo(t, INF_Integer) }
+func isNumeric(t Type) bool { return hasInfo(t, INF_Numeric) }
+func isOrdered(t Type) bool { return hasInfo(t, INF_Ordered) }
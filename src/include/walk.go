@@ -0,0 +1,160 @@
+package include
+
+import "fmt"
+
+// Cursor is a node met by Walk or Rewrite, with where it sits in the tree. It
+// is only valid during the call it was passed to.
+type Cursor struct {
+	parents []*ASTNode
+	field   string
+	index   int
+
+	// A node in LHS, RHS or Alt, or the root, lives in slot. One in Children
+	// or a group of Params lives at index in list.
+	slot    **ASTNode
+	list    *[]*ASTNode
+	deleted bool
+}
+
+// Node returns the current node.
+func (c *Cursor) Node() *ASTNode {
+	if c.list != nil {
+		return (*c.list)[c.index]
+	}
+
+	return *c.slot
+}
+
+// Parent returns the node the current one hangs off, or nil for the root.
+func (c *Cursor) Parent() *ASTNode {
+	if len(c.parents) == 0 {
+		return nil
+	}
+
+	return c.parents[len(c.parents)-1]
+}
+
+// Parents returns the chain of nodes from the root down to the parent of the
+// current node. The slice must not be changed or kept.
+func (c *Cursor) Parents() []*ASTNode {
+	return c.parents
+}
+
+// Field returns the field of the parent holding the current node: "LHS",
+// "RHS", "Alt", "Children" or "Params[i]" for the i-th group of Params. It is
+// empty for the root.
+func (c *Cursor) Field() string {
+	return c.field
+}
+
+// Index returns the position of the current node in Children or its group of
+// Params, or -1 for any other field.
+func (c *Cursor) Index() int {
+	return c.index
+}
+
+// Replace puts node in place of the current node. If called before the
+// current node's children are visited, node's children are visited instead.
+func (c *Cursor) Replace(node *ASTNode) {
+	if c.list != nil {
+		(*c.list)[c.index] = node
+		return
+	}
+
+	*c.slot = node
+}
+
+// Delete removes the current node from Children or its group of Params. It
+// panics for nodes in any other field.
+func (c *Cursor) Delete() {
+	if c.list == nil {
+		panic(fmt.Sprintf("Delete of a node in %q", c.field))
+	}
+
+	*c.list = append((*c.list)[:c.index], (*c.list)[c.index+1:]...)
+	c.deleted = true
+}
+
+// Walk visits the tree under node depth-first, in the order LHS, RHS, Alt,
+// Params and Children. Either function may be nil. pre is called before a
+// node's children, which are skipped along with post if it returns false.
+// post is called after them, and stops the whole walk if it returns false.
+func Walk(node *ASTNode, pre, post func(c *Cursor) bool) {
+	Rewrite(node, pre, post)
+}
+
+// Rewrite walks the tree under node like Walk, letting pre and post replace
+// or delete nodes through the Cursor. It returns the root, which may have
+// been replaced.
+func Rewrite(node *ASTNode, pre, post func(c *Cursor) bool) *ASTNode {
+	w := &walker{pre: pre, post: post}
+	w.slot(&node, "")
+	return node
+}
+
+// Inspect calls f for each node of the tree under node in the order of Walk,
+// skipping the children of any node it returns false for.
+func Inspect(node *ASTNode, f func(node *ASTNode) bool) {
+	Walk(node, func(c *Cursor) bool { return f(c.Node()) }, nil)
+}
+
+type walker struct {
+	pre     func(c *Cursor) bool
+	post    func(c *Cursor) bool
+	parents []*ASTNode
+	stopped bool
+}
+
+func (w *walker) slot(slot **ASTNode, field string) {
+	if *slot == nil || w.stopped {
+		return
+	}
+
+	w.visit(&Cursor{parents: w.parents, field: field, index: -1, slot: slot})
+}
+
+func (w *walker) list(list *[]*ASTNode, field string) {
+	for i := 0; i < len(*list) && !w.stopped; {
+		if (*list)[i] == nil {
+			i++
+			continue
+		}
+
+		c := &Cursor{parents: w.parents, field: field, index: i, list: list}
+		w.visit(c)
+
+		if !c.deleted {
+			i++
+		}
+	}
+}
+
+func (w *walker) visit(c *Cursor) {
+	if w.pre != nil && !w.pre(c) || c.deleted {
+		return
+	}
+
+	if node := c.Node(); node != nil {
+		w.parents = append(w.parents, node)
+
+		w.slot(&node.LHS, "LHS")
+		w.slot(&node.RHS, "RHS")
+		w.slot(&node.Alt, "Alt")
+
+		for i := range node.Params {
+			w.list(&node.Params[i], fmt.Sprintf("Params[%d]", i))
+		}
+
+		w.list(&node.Children, "Children")
+
+		w.parents = w.parents[:len(w.parents)-1]
+	}
+
+	if w.stopped || c.deleted {
+		return
+	}
+
+	if w.post != nil && !w.post(c) {
+		w.stopped = true
+	}
+}
@@ -1,21 +1,274 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/Songbird-Project/wisp/include"
 )
 
+// version is overridden at build time with -ldflags "-X main.version=..."
+var version = "0.1.0-dev"
+
+// Exit codes that don't come from a diagnostic
+const (
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+type command struct {
+	Name    string
+	Args    string
+	Summary string
+	Run     func(flags *flag.FlagSet, opts *options) int
+}
+
+// options holds the flags of all commands. Only --max-errors and --no-color
+// are taken by every command.
+type options struct {
+	MaxErrors int
+	NoColor   bool
+	Trace     bool
+	Format    string
+	Write     bool
+	List      bool
+}
+
+var commands = []command{
+	{"parse", "[--format tree|json|sexp] [--trace] [file]", "Parse a file and print its syntax tree", runParse},
+	{"check", "[file]", "Parse and type-check a file", runCheck},
+	{"build", "[file]", "Compile a file to an executable (not implemented yet)", runCompile},
+	{"run", "[file]", "Compile and run a file (not implemented yet)", runCompile},
+	{"fmt", "[-w | -l] file...", "Format files in the standard style", runFmt},
+	{"version", "", "Print the Wisp version", runVersion},
+}
+
 func main() {
-	astTree, err := include.GenerateAST()
+	os.Exit(run(os.Args[1:]))
+}
+
+// run runs the command named by the first of args, returning the exit code.
+func run(args []string) int {
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage(os.Stdout)
+		return 0
+	}
+
+	for _, cmd := range commands {
+		if cmd.Name != args[0] {
+			continue
+		}
+
+		flags := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+		opts := &options{}
+
+		flags.IntVar(&opts.MaxErrors, "max-errors", 0, "stop after this many errors, or 0 for no limit")
+		flags.BoolVar(&opts.NoColor, "no-color", false, "never colour diagnostics")
+
+		switch cmd.Name {
+		case "parse":
+			flags.StringVar(&opts.Format, "format", "tree", "print the tree as `tree`, json or sexp")
+			flags.BoolVar(&opts.Trace, "trace", false, "print each statement as it is parsed")
+		case "fmt":
+			flags.BoolVar(&opts.Write, "w", false, "write the result back to each file")
+			flags.BoolVar(&opts.List, "l", false, "only list the files whose formatting differs")
+		}
+
+		flags.Usage = func() {
+			fmt.Fprintf(flags.Output(), "%s\n\nUsage:\n  wisp %s %s\n\nFlags:\n", cmd.Summary, cmd.Name, cmd.Args)
+			flags.PrintDefaults()
+		}
+
+		if err := flags.Parse(args[1:]); err != nil {
+			if err == flag.ErrHelp {
+				return 0
+			}
+
+			return exitUsage
+		}
+
+		return cmd.Run(flags, opts)
+	}
+
+	fmt.Fprintf(os.Stderr, "wisp: unknown command %q\n\n", args[0])
+	usage(os.Stderr)
+	return exitUsage
+}
+
+func usage(w io.Writer) {
+	fmt.Fprint(w, "Wisp compiles and formats Wisp source code.\n\nUsage:\n  wisp <command> [flags] [arguments]\n\nCommands:\n")
+
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.Name, cmd.Summary)
+	}
+
+	fmt.Fprint(w, "\nRun `wisp <command> --help` for the flags of a command.\n")
+}
+
+//====== Commands ======//
+
+func runParse(flags *flag.FlagSet, opts *options) int {
+	parseOpts := &include.Options{MaxErrors: opts.MaxErrors}
+	if opts.Trace {
+		parseOpts.Trace = os.Stdout
+	}
+
+	file, code := parse(flags, opts, parseOpts)
+	if file == nil {
+		return code
+	}
+
+	var err error
+	switch opts.Format {
+	case "tree":
+		err = include.Fprint(os.Stdout, file.Root)
+	case "json":
+		err = include.WriteJSON(os.Stdout, file.Root)
+	case "sexp":
+		_, err = fmt.Println(include.Sexpr(file.Root))
+	default:
+		fmt.Fprintf(os.Stderr, "wisp parse: unknown format %q, expected tree, json or sexp\n", opts.Format)
+		return exitUsage
+	}
+
 	if err != nil {
-		fmt.Printf("%s\n", err.Info)
-		os.Exit(err.ExitCode)
+		fmt.Fprintf(os.Stderr, "wisp parse: %s\n", err)
+		return exitFailure
 	}
 
-	fmt.Println("\nResult:")
-	for _, node := range astTree.Children {
-		fmt.Printf("Value: %s, Kind: %s\n", node.Value, node.Kind)
+	return code
+}
+
+func runCheck(flags *flag.FlagSet, opts *options) int {
+	_, _, code := check(flags, opts)
+	return code
+}
+
+// runCompile backs both build and run. It checks the file and lowers it for
+// code generation, which doesn't exist yet, so it fails after that.
+func runCompile(flags *flag.FlagSet, opts *options) int {
+	file, info, code := check(flags, opts)
+	if file == nil || code != 0 {
+		return code
+	}
+
+	include.InlineConstants(file.Root, info)
+	include.Lower(file.Root, info)
+	include.LowerCasts(file.Root, info)
+
+	fmt.Fprintf(os.Stderr, "wisp: %s: there is no code generator yet, the source was only checked\n", flags.Name())
+	return exitFailure
+}
+
+func runFmt(flags *flag.FlagSet, opts *options) int {
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	status := 0
+
+	for _, path := range flags.Args() {
+		file := include.ParseFile(path, &include.Options{MaxErrors: opts.MaxErrors})
+		if code := report(file, opts); code != 0 {
+			status = code
+			continue
+		}
+
+		formatted := include.Format(file)
+
+		switch {
+		case opts.List:
+			if formatted != file.Src {
+				fmt.Println(path)
+			}
+		case opts.Write:
+			if formatted == file.Src {
+				continue
+			}
+
+			if err := os.WriteFile(path, []byte(formatted), 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "wisp: fmt: %s\n", err)
+				status = exitFailure
+			}
+		default:
+			fmt.Print(formatted)
+		}
+	}
+
+	return status
+}
+
+func runVersion(flags *flag.FlagSet, opts *options) int {
+	fmt.Printf("wisp version %s\n", version)
+	return 0
+}
+
+//====== Helpers ======//
+
+// parse parses the one file named in flags, or main.wp without one, and
+// reports its diagnostics. It returns the file and the exit code so far, or
+// no file if the arguments were wrong.
+func parse(flags *flag.FlagSet, opts *options, parseOpts *include.Options) (*include.File, int) {
+	if flags.NArg() > 1 {
+		fmt.Fprintf(os.Stderr, "wisp %s: expected one file, got %d\n", flags.Name(), flags.NArg())
+		return nil, exitUsage
+	}
+
+	path := "main.wp"
+	if flags.NArg() == 1 {
+		path = flags.Arg(0)
+	}
+
+	file := include.ParseFile(path, parseOpts)
+	return file, report(file, opts)
+}
+
+// check parses and type-checks the file named in flags like parse. The Info
+// is nil if the file didn't parse.
+func check(flags *flag.FlagSet, opts *options) (*include.File, *include.Info, int) {
+	file, code := parse(flags, opts, &include.Options{MaxErrors: opts.MaxErrors})
+	if file == nil || code != 0 {
+		return file, nil, code
 	}
+
+	info, diags := include.Check(file)
+	file.Diags = diags
+	return file, info, report(file, opts)
+}
+
+// report renders the diagnostics of file to stderr, returning the code of the
+// first error as the exit code, or 0 if there are none.
+func report(file *include.File, opts *options) int {
+	code := 0
+
+	for _, diag := range file.Diags {
+		diag.Render(os.Stderr, file.Src, !opts.NoColor && useColor())
+		fmt.Fprintln(os.Stderr)
+
+		if code == 0 && diag.Severity == include.SEV_Error {
+			code = diag.Code
+		}
+	}
+
+	return code
+}
+
+// useColor reports whether diagnostics should be coloured: only on terminals,
+// and never when NO_COLOR is set.
+func useColor() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+
+	stat, err := os.Stderr.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
 }